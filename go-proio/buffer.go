@@ -0,0 +1,71 @@
+package proio
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Size of the buffer placed between a Reader and its stream
+const readBufferSize = 1 << 16
+
+// Returns a buffered version of a stream for a Reader.  Streams that are
+// seekable remain so.
+func newBufferedReader(byteReader io.Reader) io.Reader {
+	switch byteReader := byteReader.(type) {
+	case *blockGzipReader, *mappedReader:
+		// Already buffered, and virtual offsets cannot be adjusted for
+		// buffered bytes
+		return byteReader
+	case io.ReadSeeker:
+		return &bufferedReadSeeker{
+			Reader: bufio.NewReaderSize(byteReader, readBufferSize),
+			seeker: byteReader,
+		}
+	}
+	return bufio.NewReaderSize(byteReader, readBufferSize)
+}
+
+// bufferedReadSeeker is a bufio.Reader that can seek, accounting for bytes
+// that have been buffered but not yet read
+type bufferedReadSeeker struct {
+	*bufio.Reader
+	seeker io.ReadSeeker
+}
+
+func (rdr *bufferedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	buffered := int64(rdr.Buffered())
+	if whence == 1 /*io.SeekCurrent*/ {
+		if offset >= 0 && offset <= buffered {
+			rdr.Discard(int(offset))
+			pos, err := rdr.seeker.Seek(0, 1 /*io.SeekCurrent*/)
+			return pos - buffered + offset, err
+		}
+		offset -= buffered
+	}
+
+	pos, err := rdr.seeker.Seek(offset, whence)
+	rdr.Reset(rdr.seeker)
+	return pos, err
+}
+
+// Buffers holding the frames of events are recycled through framePool once
+// released with (*Event) Release()
+var framePool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+func getFrameBuffer(size int) []byte {
+	buf := framePool.Get().(*[]byte)
+	if cap(*buf) < size {
+		return make([]byte, size)
+	}
+	return (*buf)[:size]
+}
+
+func putFrameBuffer(buf []byte) {
+	buf = buf[:0]
+	framePool.Put(&buf)
+}
@@ -0,0 +1,91 @@
+package proio
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func TestRelease(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), 3, nil)
+
+	reader := NewReader(buffer)
+	var MCParticles []*prolcio.MCParticleCollection
+	for reader.Next(context.Background()) {
+		event := reader.Event()
+		MCParticles = append(MCParticles, event.Get("MCParticles").(*prolcio.MCParticleCollection))
+		event.Release()
+		if len(event.GetNames()) != 1 {
+			t.Error("Release() dropped retrieved collection")
+		}
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Collections must not refer to recycled buffers
+	for i, coll := range MCParticles {
+		if len(coll.Entries) != 1 || coll.Entries[0].PDG != int32(i) {
+			t.Errorf("Event %v corrupted after Release()", i)
+		}
+	}
+}
+
+func TestOpenMapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "mapped.proio")
+	writer, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestEvents(t, writer, 3, nil)
+
+	reader, err := OpenMapped(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reader.byteReader.(*mappedReader); !ok {
+		t.Fatal("File not mapped")
+	}
+	checkTestEvents(t, reader, 3, "mapped")
+
+	// Removing a collection must not write to the mapped file
+	if err := reader.SeekToEvent(1); err != nil {
+		t.Fatal(err)
+	}
+	event, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Add(&prolcio.MCParticleCollection{}, "Extra")
+	event.Remove("MCParticles")
+	if err := reader.SeekToStart(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestEvents(t, reader, 3, "mapped")
+	reader.Close()
+
+	// Compressed files are read as usual
+	writer, err = Create(filename + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestEvents(t, writer, 3, nil)
+	reader, err = OpenMapped(filename + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestEvents(t, reader, 3, "gzip")
+	reader.Close()
+}
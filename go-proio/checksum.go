@@ -0,0 +1,76 @@
+package proio
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// Records with checksumFlag set in their type carry two CRC-32C checksums
+// between the sizes and the header: one of the two sizes, so that a corrupted
+// size is caught before it is used, and one of the header followed by the
+// payload.  Readers predating checksums skip these records, reporting
+// ErrResync, so only records that such readers skip anyway are written this
+// way.
+const checksumFlag = 0x80
+
+// Size of the checksums of a record with checksumFlag set
+const checksumSize = 8
+
+// Event records keep their type instead, and carry the same two checksums in
+// a leading fixed64 field of the header.  The field number is not used by
+// EventHeader, so readers predating checksums skip the field and read the
+// event as usual.  Marshaled headers never begin with the field otherwise,
+// since fields are marshaled in order of number, and the one following it
+// starts with a two-byte tag.
+const (
+	headerChecksumTag  = 15<<3 | 1 // field 15, fixed64
+	headerChecksumSize = 1 + checksumSize
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func frameChecksum(header []byte, payload []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, crcTable), crcTable, payload)
+}
+
+func sizesChecksum(headerSize uint32, payloadSize uint32) uint32 {
+	var sizes [8]byte
+	binary.LittleEndian.PutUint32(sizes[:], headerSize)
+	binary.LittleEndian.PutUint32(sizes[4:], payloadSize)
+	return crc32.Checksum(sizes[:], crcTable)
+}
+
+// Returns the header of an event record with the checksum field prepended
+func addHeaderChecksum(header []byte, payload []byte) []byte {
+	checked := make([]byte, headerChecksumSize+len(header))
+	checked[0] = headerChecksumTag
+	binary.LittleEndian.PutUint32(checked[1:], sizesChecksum(uint32(len(checked)), uint32(len(payload))))
+	binary.LittleEndian.PutUint32(checked[5:], frameChecksum(header, payload))
+	copy(checked[headerChecksumSize:], header)
+	return checked
+}
+
+// Verifies the sizes of an event record against the checksum field at the
+// start of its header, if there is one, so that a corrupted size is caught
+// before the rest of the record is read
+func checkSizesChecksum(headerStart []byte, headerSize uint32, payloadSize uint32) error {
+	if len(headerStart) < headerChecksumSize || headerStart[0] != headerChecksumTag {
+		return nil
+	}
+	if sizesChecksum(headerSize, payloadSize) != binary.LittleEndian.Uint32(headerStart[1:]) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Verifies the header and payload of an event record against the checksum
+// field of its header, if there is one, and returns the header without it
+func checkHeaderChecksum(header []byte, payload []byte) ([]byte, error) {
+	if len(header) < headerChecksumSize || header[0] != headerChecksumTag {
+		return header, nil
+	}
+	if frameChecksum(header[headerChecksumSize:], payload) != binary.LittleEndian.Uint32(header[5:]) {
+		return nil, ErrChecksum
+	}
+	return header[headerChecksumSize:], nil
+}
@@ -0,0 +1,64 @@
+package proio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+func TestChecksums(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.Checksums = true
+	writer.EmbedDescriptors = true
+	writeTestEvents(t, writer, 3, nil)
+	stream := buffer.Bytes()
+	checkTestEvents(t, NewReader(bytes.NewReader(stream)), 3, "checksums")
+
+	idx, err := NewReader(bytes.NewReader(stream)).Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 3 {
+		t.Fatalf("Indexed %v events instead of 3", idx.NEvents())
+	}
+
+	// Event records keep their type, and their headers remain readable by
+	// readers predating checksums, which skip the checksum field
+	entry := idx.Entries[1]
+	headerStart := entry.Offset + int64(len(magicBytes)) + 8
+	if recordType := stream[entry.Offset+int64(len(magicBytes))-1]; recordType != eventRecord {
+		t.Errorf("Event record has type %#x", recordType)
+	}
+	header := &model.EventHeader{}
+	if err := header.Unmarshal(stream[headerStart : headerStart+int64(entry.HeaderSize)]); err != nil || header.EventNumber != 1 {
+		t.Errorf("Failed to unmarshal checksummed header: %v", err)
+	}
+
+	// Flip a bit in the payload of the second event
+	corrupt := append([]byte(nil), stream...)
+	corrupt[headerStart+int64(entry.HeaderSize)] ^= 1
+	reader := NewReader(bytes.NewReader(corrupt))
+	if _, err := reader.Get(); err != nil {
+		t.Error(err)
+	}
+	if event, err := reader.Get(); err != ErrChecksum || event != nil {
+		t.Errorf("Corrupted payload returned %v", err)
+	}
+	if event, err := reader.Get(); err != nil || event.Header.EventNumber != 2 {
+		t.Errorf("Failed to read past corrupted payload: %v", err)
+	}
+
+	// Corrupt the payload size of the second event
+	corrupt = append([]byte(nil), stream...)
+	corrupt[entry.Offset+int64(len(magicBytes))+4] ^= 0x40
+	reader = NewReader(bytes.NewReader(corrupt))
+	reader.Get()
+	if event, err := reader.Get(); err != ErrChecksum || event != nil {
+		t.Errorf("Corrupted size returned %v", err)
+	}
+	if event, err := reader.Get(); err != ErrResync || event.Header.EventNumber != 2 {
+		t.Errorf("Failed to resync past corrupted size: %v", err)
+	}
+}
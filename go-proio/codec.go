@@ -0,0 +1,473 @@
+package proio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"github.com/ulikunitz/xz"
+)
+
+// Codec describes a compression format that may wrap a proio stream.  Codecs
+// are selected by file name suffix in Open() and Create(), and by magic bytes
+// at the start of the stream in NewReader().
+type Codec struct {
+	Name   string
+	Suffix string
+	Magic  []byte
+	// ID identifies the codec in events whose payloads are compressed
+	// independently (see Writer.PayloadCodec).  Zero means that the codec
+	// cannot be used for this.
+	ID byte
+
+	NewReader func(io.Reader) (io.ReadCloser, error)
+	// NewWriter is nil for codecs that can only be read
+	NewWriter func(io.Writer) (io.WriteCloser, error)
+
+	// Compress and decompress whole event payloads, reusing state between
+	// events.  Where these are nil, NewWriter and NewReader are used.
+	compressAll   func(dst, src []byte) ([]byte, error)
+	decompressAll func(src []byte, size uint64) ([]byte, error)
+}
+
+var (
+	ErrReadOnlyCodec = errors.New("codec does not support writing")
+	ErrUnknownCodec  = errors.New("codec is unknown or has no ID")
+)
+
+var (
+	codecs      []*Codec
+	codecsMutex sync.RWMutex
+)
+
+// Registers a codec for use by Open(), Create() and NewReader().  A codec
+// registered with the same name as an existing codec replaces it.
+func RegisterCodec(codec *Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	for i, existing := range codecs {
+		if existing.Name == codec.Name {
+			codecs[i] = codec
+			return
+		}
+	}
+	codecs = append(codecs, codec)
+}
+
+// Returns the registered codec with the given name, or nil
+func GetCodec(name string) *Codec {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	for _, codec := range codecs {
+		if codec.Name == name {
+			return codec
+		}
+	}
+	return nil
+}
+
+func codecForID(id byte) *Codec {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	for _, codec := range codecs {
+		if id != 0 && codec.ID == id {
+			return codec
+		}
+	}
+	return nil
+}
+
+func codecForFilename(filename string) *Codec {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	for _, codec := range codecs {
+		if codec.Suffix != "" && strings.HasSuffix(filename, codec.Suffix) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// Returns the codec whose magic bytes start the given buffer, or nil
+func sniffCodec(buf []byte) *Codec {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	for _, codec := range codecs {
+		if len(codec.Magic) > 0 && bytes.HasPrefix(buf, codec.Magic) {
+			return codec
+		}
+	}
+	return nil
+}
+
+func maxMagicLen() int {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	maxLen := 0
+	for _, codec := range codecs {
+		if len(codec.Magic) > maxLen {
+			maxLen = len(codec.Magic)
+		}
+	}
+	return maxLen
+}
+
+type closerFunc struct {
+	io.Reader
+	close func() error
+}
+
+func (rc closerFunc) Close() error {
+	return rc.close()
+}
+
+func init() {
+	RegisterCodec(&Codec{
+		Name:      "gzip",
+		ID:        1,
+		Suffix:    ".gz",
+		Magic:     []byte{0x1f, 0x8b},
+		NewReader: newGzipReader,
+		NewWriter: func(byteWriter io.Writer) (io.WriteCloser, error) {
+			return newBlockGzipWriter(byteWriter), nil
+		},
+		compressAll:   gzipCompressAll,
+		decompressAll: gzipDecompressAll,
+	})
+
+	RegisterCodec(&Codec{
+		Name:   "zstd",
+		ID:     2,
+		Suffix: ".zst",
+		Magic:  []byte{0x28, 0xb5, 0x2f, 0xfd},
+		NewReader: func(byteReader io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(byteReader)
+			if err != nil {
+				return nil, err
+			}
+			return closerFunc{decoder, func() error {
+				decoder.Close()
+				return nil
+			}}, nil
+		},
+		NewWriter: func(byteWriter io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(byteWriter)
+		},
+		compressAll:   zstdCompressAll,
+		decompressAll: zstdDecompressAll,
+	})
+
+	RegisterCodec(&Codec{
+		Name:   "lz4",
+		ID:     3,
+		Suffix: ".lz4",
+		Magic:  []byte{0x04, 0x22, 0x4d, 0x18},
+		NewReader: func(byteReader io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(lz4.NewReader(byteReader)), nil
+		},
+		NewWriter: func(byteWriter io.Writer) (io.WriteCloser, error) {
+			return lz4.NewWriter(byteWriter), nil
+		},
+	})
+
+	RegisterCodec(&Codec{
+		Name:   "xz",
+		ID:     4,
+		Suffix: ".xz",
+		Magic:  []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		NewReader: func(byteReader io.Reader) (io.ReadCloser, error) {
+			xzReader, err := xz.NewReader(byteReader)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(xzReader), nil
+		},
+		NewWriter: func(byteWriter io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(byteWriter)
+		},
+	})
+
+	RegisterCodec(&Codec{
+		Name:   "bzip2",
+		ID:     5,
+		Suffix: ".bz2",
+		Magic:  []byte{'B', 'Z', 'h'},
+		NewReader: func(byteReader io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(byteReader)), nil
+		},
+	})
+}
+
+// Opens a compressed stream with the given codec and adds it as an io.Reader
+// to a new Reader that is returned.  The Close() function should be called
+// before closing the stream.
+func NewCompressedReader(byteReader io.Reader, codec *Codec) (*Reader, error) {
+	decompressor, err := codec.NewReader(byteReader)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newReader(decompressor)
+	reader.deferUntilClose(decompressor.Close)
+
+	return reader, nil
+}
+
+// Creates a compressed stream with the given codec and adds it as an
+// io.Writer to a new Writer that is returned.  The Close() function should be
+// called before closing the stream.
+func NewCompressedWriter(byteWriter io.Writer, codec *Codec) (*Writer, error) {
+	if codec.NewWriter == nil {
+		return nil, ErrReadOnlyCodec
+	}
+	compressor, err := codec.NewWriter(byteWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := NewWriter(compressor)
+	writer.deferUntilClose(compressor.Close)
+
+	return writer, nil
+}
+
+// Determines whether a seekable stream is compressed by peeking at its first
+// bytes, and rewinds it.  The returned bool is false if the stream cannot
+// seek, and the returned codec is nil for uncompressed streams.
+func sniffSeekable(byteReader io.Reader) (*Codec, bool, error) {
+	seeker, ok := byteReader.(io.ReadSeeker)
+	if !ok {
+		return nil, false, nil
+	}
+	start, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	buf := make([]byte, maxMagicLen())
+	n, _ := io.ReadFull(seeker, buf)
+	if _, err := seeker.Seek(start, 0 /*io.SeekStart*/); err != nil {
+		return nil, true, err
+	}
+	return sniffCodec(buf[:n]), true, nil
+}
+
+// sniffingReader determines whether a stream that cannot seek is compressed
+// by peeking at its first bytes on the first read, so that creating a Reader
+// does not block waiting for data.  Errors in peeking or in setting up
+// decompression are returned by every read.
+type sniffingReader struct {
+	byteReader   io.Reader
+	reader       io.Reader
+	decompressor io.ReadCloser
+	err          error
+}
+
+func (rdr *sniffingReader) Read(p []byte) (int, error) {
+	if rdr.reader == nil && rdr.err == nil {
+		rdr.sniff()
+	}
+	if rdr.err != nil {
+		return 0, rdr.err
+	}
+	return rdr.reader.Read(p)
+}
+
+func (rdr *sniffingReader) sniff() {
+	bufReader, ok := rdr.byteReader.(*bufio.Reader)
+	if !ok {
+		bufReader = bufio.NewReader(rdr.byteReader)
+	}
+	buf, err := bufReader.Peek(maxMagicLen())
+	if err != nil && err != io.EOF {
+		rdr.err = err
+		return
+	}
+
+	codec := sniffCodec(buf)
+	if codec == nil {
+		rdr.reader = bufReader
+		return
+	}
+	if rdr.decompressor, rdr.err = codec.NewReader(bufReader); rdr.err == nil {
+		rdr.reader = rdr.decompressor
+	}
+}
+
+func (rdr *sniffingReader) Close() error {
+	if rdr.decompressor != nil {
+		return rdr.decompressor.Close()
+	}
+	return nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (rdr errReader) Read([]byte) (int, error) {
+	return 0, rdr.err
+}
+
+// Compresses an event payload with the given codec.  The compressed payload is
+// prefixed with the codec ID.
+func compressPayload(payload []byte, codec *Codec) ([]byte, error) {
+	if codec.ID == 0 {
+		return nil, ErrUnknownCodec
+	}
+	if codec.compressAll != nil {
+		return codec.compressAll([]byte{codec.ID}, payload)
+	}
+	if codec.NewWriter == nil {
+		return nil, ErrReadOnlyCodec
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(codec.ID)
+	compressor, err := codec.NewWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := compressor.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Reverses compressPayload().  The payload must decompress to exactly size
+// bytes, the total size of the collections given by the event header, and
+// decompression stops as soon as it exceeds them, returning ErrPayloadSize.
+func decompressPayload(payload []byte, size uint64) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, ErrTruncated
+	}
+	codec := codecForID(payload[0])
+	if codec == nil {
+		return nil, ErrUnknownCodec
+	}
+	if codec.decompressAll != nil {
+		return codec.decompressAll(payload[1:], size)
+	}
+
+	decompressor, err := codec.NewReader(bytes.NewReader(payload[1:]))
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	return readPayload(decompressor, size)
+}
+
+// Reads exactly size bytes of decompressed payload, followed by the end of the
+// stream
+func readPayload(decompressor io.Reader, size uint64) ([]byte, error) {
+	decompressed, err := ioutil.ReadAll(io.LimitReader(decompressor, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(decompressed)) != size {
+		return nil, ErrPayloadSize
+	}
+	return decompressed, nil
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	gzipReaders = sync.Pool{New: func() interface{} { return new(gzip.Reader) }}
+)
+
+func gzipCompressAll(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	compressor := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(compressor)
+
+	compressor.Reset(buf)
+	if _, err := compressor.Write(src); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompressAll(src []byte, size uint64) ([]byte, error) {
+	decompressor := gzipReaders.Get().(*gzip.Reader)
+	defer gzipReaders.Put(decompressor)
+
+	if err := decompressor.Reset(bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	return readPayload(decompressor, size)
+}
+
+// The zstd encoder and decoder are safe for concurrent use by EncodeAll() and
+// DecodeAll(), and are created on first use
+var (
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+	zstdEncoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+	zstdDecoderOnce sync.Once
+)
+
+func zstdCompressAll(dst, src []byte) ([]byte, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+	if zstdEncoderErr != nil {
+		return nil, zstdEncoderErr
+	}
+	return zstdEncoder.EncodeAll(src, dst), nil
+}
+
+func zstdDecompressAll(src []byte, size uint64) ([]byte, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil, zstd.WithDecodeAllCapLimit(true))
+	})
+	if zstdDecoderErr != nil {
+		return nil, zstdDecoderErr
+	}
+
+	// Frames state their decompressed size, which is checked before
+	// allocating for it
+	var frameHeader zstd.Header
+	if err := frameHeader.Decode(src); err != nil {
+		return nil, err
+	}
+	if frameHeader.HasFCS && frameHeader.FrameContentSize != size {
+		return nil, ErrPayloadSize
+	}
+
+	// With the capacity limit, decoding fails rather than grow the buffer
+	decompressed, err := zstdDecoder.DecodeAll(src, make([]byte, 0, size))
+	if err == zstd.ErrDecoderSizeExceeded {
+		return nil, ErrPayloadSize
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(decompressed)) != size {
+		return nil, ErrPayloadSize
+	}
+	return decompressed, nil
+}
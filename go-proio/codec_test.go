@@ -0,0 +1,298 @@
+package proio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func TestCodecFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, codecName := range []string{"gzip", "zstd", "xz"} {
+		filename := filepath.Join(dir, "codec.proio"+GetCodec(codecName).Suffix)
+
+		writer, err := Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestEvents(t, writer, 3, nil)
+
+		reader, err := Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestEvents(t, reader, 3, codecName)
+		reader.Close()
+	}
+
+	if _, err := Create(filepath.Join(dir, "codec.proio.bz2")); err != ErrReadOnlyCodec {
+		t.Errorf("Creating a bzip2 file returned %v", err)
+	}
+}
+
+func TestCodecSniffing(t *testing.T) {
+	for _, codecName := range []string{"", "gzip", "zstd"} {
+		buffer := &bytes.Buffer{}
+		var writer *Writer
+		if codecName == "" {
+			writer = NewWriter(buffer)
+		} else {
+			var err error
+			writer, err = NewCompressedWriter(buffer, GetCodec(codecName))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeTestEvents(t, writer, 3, nil)
+
+		reader := NewReader(buffer)
+		checkTestEvents(t, reader, 3, codecName)
+		reader.Close()
+	}
+}
+
+func TestLazySniffing(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer, err := NewCompressedWriter(buffer, GetCodec("gzip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestEvents(t, writer, 3, nil)
+
+	// Creating a Reader must not wait for data
+	pipeReader, pipeWriter := io.Pipe()
+	reader := NewReader(pipeReader)
+	go func() {
+		pipeWriter.Write(buffer.Bytes())
+		pipeWriter.Close()
+	}()
+	checkTestEvents(t, reader, 3, "pipe")
+	reader.Close()
+
+	// Errors in peeking are passed on
+	pipeReader, pipeWriter = io.Pipe()
+	pipeWriter.CloseWithError(io.ErrUnexpectedEOF)
+	if _, err := NewReader(pipeReader).Get(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Get() after failed peek returned %v", err)
+	}
+}
+
+func TestPayloadCompression(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.PayloadCodec = GetCodec("zstd")
+	writeTestEvents(t, writer, 3, nil)
+
+	reader := NewReader(bytes.NewReader(buffer.Bytes()))
+	checkTestEvents(t, reader, 3, "zstd payload")
+
+	if err := reader.SeekToStart(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Skip(1); err != nil {
+		t.Fatal(err)
+	}
+	header, err := reader.GetHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.EventNumber != 1 {
+		t.Errorf("Got header for event %v instead of 1", header.EventNumber)
+	}
+
+	if err := reader.SeekToEvent(2); err != nil {
+		t.Fatal(err)
+	}
+	event, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if MCParticles := event.Get("MCParticles").(*prolcio.MCParticleCollection); MCParticles.Entries[0].PDG != 2 {
+		t.Error("Seeked to the wrong event")
+	}
+	reader.Close()
+
+	// A payload that decompresses beyond the sizes in the header is rejected
+	headerBuf, err := (&model.EventHeader{
+		PayloadCollections: []*model.EventHeader_CollectionHeader{{Name: "A", PayloadSize: 10}},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gzip", "zstd", "lz4"} {
+		payload, err := compressPayload(make([]byte, 1<<20), GetCodec(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer.Reset()
+		writer = NewWriter(buffer)
+		if err := writer.writeRecord(compressedEventRecord, headerBuf, payload); err != nil {
+			t.Fatal(err)
+		}
+		if event, err := NewReader(bytes.NewReader(buffer.Bytes())).Get(); err != ErrPayloadSize || event != nil {
+			t.Errorf("Oversized %v payload returned %v", name, err)
+		}
+	}
+
+	writer = NewWriter(&bytes.Buffer{})
+	writer.PayloadCodec = &Codec{Name: "noid", NewWriter: GetCodec("gzip").NewWriter}
+	if err := writer.Push(NewEvent()); err != ErrUnknownCodec {
+		t.Errorf("Pushing with a codec without an ID returned %v", err)
+	}
+}
+
+func TestGzipBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "blocks.proio.gz")
+
+	writer, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.GzipBlockSize = 200
+	writeTestEvents(t, writer, 20, func(i int, event *Event) {
+		MCParticles := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+		for j := 1; j <= i; j++ {
+			MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: int32(j)})
+		}
+	})
+
+	reader, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Skip(3); err != nil {
+		t.Fatal(err)
+	}
+	header, err := reader.GetHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.EventNumber != 3 {
+		t.Errorf("Got header for event %v instead of 3", header.EventNumber)
+	}
+
+	idx, err := reader.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 20 {
+		t.Errorf("Index has %v events instead of 20", idx.NEvents())
+	}
+	for _, n := range []int{17, 4, 19, 0} {
+		if err := reader.SeekToEvent(n); err != nil {
+			t.Fatal(err)
+		}
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nEntries := event.Get("MCParticles").GetNEntries(); nEntries != uint32(n+1) {
+			t.Errorf("Event %v has %v entries instead of %v", n, nEntries, n+1)
+		}
+	}
+}
+
+func TestGzipBlocksLargeEvent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "large.proio.gz")
+
+	writer, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.GzipBlockSize = MaxGzipBlockSize
+	// The last member ends with an empty block from flushing, so that it
+	// only reports its end after its last event has been read
+	writeTestEvents(t, writer, 3, func(i int, event *Event) {
+		if i > 0 {
+			MCParticles := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+			MCParticles.Entries[0].P = make([]float64, 2*MaxGzipBlockSize/8)
+		}
+	})
+
+	reader, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	idx, err := reader.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 3 {
+		t.Fatalf("Indexed %v events instead of 3", idx.NEvents())
+	}
+	for _, n := range []int{2, 1, 0} {
+		if err := reader.SeekToEvent(n); err != nil {
+			t.Fatal(err)
+		}
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Header.EventNumber != uint64(n) {
+			t.Errorf("Seeked to event %v instead of %v", event.Header.EventNumber, n)
+		}
+	}
+
+	reader.SeekToStart()
+	reader.Recover = true
+	checkTestEvents(t, reader, 3, "recovered")
+}
+
+func TestUnblockedGzip(t *testing.T) {
+	filename := "../samples/smallSample.proio.gz"
+	reader, err := Open(filename)
+	if err != nil {
+		t.Skip("Skipping unblocked gzip test: missing input file ", filename)
+	}
+	defer reader.Close()
+	plainReader, err := Open("../samples/smallSample.proio")
+	if err != nil {
+		t.Skip("Skipping unblocked gzip test: missing input file ", filename)
+	}
+	defer plainReader.Close()
+
+	// Ordinary gzip files cannot be seeked, but events can still be skipped
+	if err := reader.SeekToEvent(5); err != ErrNotSeekable {
+		t.Errorf("SeekToEvent() returned %v", err)
+	}
+	if n, err := reader.Skip(5); n != 5 || err != nil {
+		t.Fatalf("Skipped %v events with error %v", n, err)
+	}
+	header, err := reader.GetHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainReader.Skip(5)
+	plainHeader, err := plainReader.GetHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.EventNumber != plainHeader.EventNumber {
+		t.Errorf("Got event %v instead of %v", header.EventNumber, plainHeader.EventNumber)
+	}
+}
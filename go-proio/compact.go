@@ -0,0 +1,140 @@
+package proio
+
+import (
+	"sort"
+)
+
+// DanglingRefs selects what (*Event) Compact() does with References to
+// messages that are not in the event, e.g. into collections that have been
+// removed.
+type DanglingRefs int
+
+const (
+	// Dangling References are kept, with IDs that are unique but do not
+	// resolve
+	KeepDanglingRefs DanglingRefs = iota
+	// Dangling References are set to point nowhere (both IDs zero)
+	NullDanglingRefs
+	// Dangling References are removed from the entries that hold them
+	DropDanglingRefs
+)
+
+// Compact renumbers the unique IDs of the event densely, starting from one,
+// and rewrites every Reference accordingly.  Only collections and entries that
+// are actually referenced keep an ID, and Header.NUniqueIDs is reduced to the
+// number of IDs in use.  This is useful after removing collections, since IDs
+// are otherwise never reclaimed.  Every collection is deserialized as with
+// (*Event) GetE().  If any collection cannot be decoded, the error is returned
+// and the event is left unchanged.
+func (evt *Event) Compact(dangling DanglingRefs) error {
+	names := evt.GetNames()
+	sort.Strings(names)
+
+	colls := make([]Collection, len(names))
+	for i, name := range names {
+		var err error
+		if colls[i], err = evt.GetE(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		evt.MarkDirty(name)
+	}
+
+	existing := make(map[refKey]bool)
+	for _, coll := range colls {
+		collID := coll.GetId()
+		if collID == 0 {
+			continue
+		}
+		existing[refKey{collID, 0}] = true
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			if entry, ok := coll.GetEntry(i).(Message); ok && entry.GetId() != 0 {
+				existing[refKey{collID, entry.GetId()}] = true
+			}
+		}
+	}
+
+	// Handle dangling References first, so that only live References are
+	// counted
+	referenced := make(map[refKey]bool)
+	eachEntry(colls, func(entry Message) {
+		visitReferences(entry, "", func(_ string, key refKey, update func(refKey)) bool {
+			if existing[key] {
+				referenced[key] = true
+				referenced[refKey{key.collID, 0}] = true
+				return true
+			}
+			switch dangling {
+			case NullDanglingRefs:
+				update(refKey{})
+			case DropDanglingRefs:
+				return false
+			}
+			return true
+		})
+	})
+
+	nIDs := uint32(0)
+	newIDs := make(map[refKey]uint32)
+	newID := func(key refKey) uint32 {
+		if key.collID == 0 && key.entryID == 0 {
+			return 0
+		}
+		id, ok := newIDs[key]
+		if !ok {
+			nIDs++
+			id = nIDs
+			newIDs[key] = id
+		}
+		return id
+	}
+
+	for _, coll := range colls {
+		collID := coll.GetId()
+		collKey := refKey{collID, 0}
+		if !referenced[collKey] {
+			coll.SetId(0)
+		} else {
+			coll.SetId(newID(collKey))
+		}
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			entry, ok := coll.GetEntry(i).(Message)
+			if !ok || entry.GetId() == 0 {
+				continue
+			}
+			entryKey := refKey{collID, entry.GetId()}
+			if !referenced[entryKey] {
+				entry.SetId(0)
+			} else {
+				entry.SetId(newID(entryKey))
+			}
+		}
+	}
+
+	eachEntry(colls, func(entry Message) {
+		visitReferences(entry, "", func(_ string, key refKey, update func(refKey)) bool {
+			if key.entryID == 0 {
+				update(refKey{newID(key), 0})
+			} else {
+				update(refKey{newID(refKey{key.collID, 0}), newID(key)})
+			}
+			return true
+		})
+	})
+
+	evt.Header.NUniqueIDs = nIDs
+	evt.refs = nil
+
+	return nil
+}
+
+func eachEntry(colls []Collection, do func(Message)) {
+	for _, coll := range colls {
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			if entry, ok := coll.GetEntry(i).(Message); ok {
+				do(entry)
+			}
+		}
+	}
+}
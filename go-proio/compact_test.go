@@ -0,0 +1,72 @@
+package proio
+
+import (
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func newCompactTestEvent() (*Event, *prolcio.MCParticleCollection) {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	removed := &prolcio.MCParticleCollection{}
+	event.Add(removed, "Removed")
+
+	parent := &prolcio.MCParticle{PDG: 11}
+	unreferenced := &prolcio.MCParticle{PDG: 13}
+	child := &prolcio.MCParticle{PDG: 22}
+	MCParticles.Entries = append(MCParticles.Entries, parent, unreferenced, child)
+	removedPart := &prolcio.MCParticle{PDG: 2212}
+	removed.Entries = append(removed.Entries, removedPart)
+
+	event.Reference(unreferenced)
+	child.Parents = append(child.Parents, event.Reference(removedPart), event.Reference(parent))
+	event.Remove("Removed")
+
+	return event, MCParticles
+}
+
+func TestCompact(t *testing.T) {
+	for _, dangling := range []DanglingRefs{KeepDanglingRefs, NullDanglingRefs, DropDanglingRefs} {
+		event, MCParticles := newCompactTestEvent()
+		if err := event.Compact(dangling); err != nil {
+			t.Fatal(err)
+		}
+
+		parent, unreferenced, child := MCParticles.Entries[0], MCParticles.Entries[1], MCParticles.Entries[2]
+		if unreferenced.Id != 0 {
+			t.Errorf("Unreferenced particle kept ID %v", unreferenced.Id)
+		}
+		if MCParticles.Id != 1 || parent.Id != 2 {
+			t.Errorf("IDs were renumbered to %v and %v", MCParticles.Id, parent.Id)
+		}
+
+		switch dangling {
+		case KeepDanglingRefs:
+			if len(child.Parents) != 2 || event.Dereference(child.Parents[0]) != nil {
+				t.Error("Dangling reference was not kept")
+			}
+			if event.Header.NUniqueIDs != 4 {
+				t.Errorf("Event has %v unique IDs instead of 4", event.Header.NUniqueIDs)
+			}
+		case NullDanglingRefs:
+			if len(child.Parents) != 2 || child.Parents[0].CollID != 0 || child.Parents[0].EntryID != 0 {
+				t.Error("Dangling reference was not nulled")
+			}
+		case DropDanglingRefs:
+			if len(child.Parents) != 1 {
+				t.Error("Dangling reference was not dropped")
+			}
+			if err := event.Validate(); err != nil {
+				t.Error(err)
+			}
+		}
+		if dangling != KeepDanglingRefs && event.Header.NUniqueIDs != 2 {
+			t.Errorf("Event has %v unique IDs instead of 2", event.Header.NUniqueIDs)
+		}
+		if event.Dereference(child.Parents[len(child.Parents)-1]) != parent {
+			t.Error("Live reference does not resolve after compacting")
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package proio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// Metadata key under which a serialized descriptor.FileDescriptorSet is
+// stored in the stream
+const descriptorsKey = "proio.FileDescriptorSet"
+
+// descriptorPool holds protobuf file descriptors that were read from a stream,
+// and provides the message types needed to build dynamic messages for
+// collections that are unknown to the binary.  It is safe for concurrent use,
+// since events may be inspected while the Reader is still adding descriptors.
+type descriptorPool struct {
+	sync.RWMutex
+
+	files    map[string]*descriptor.FileDescriptorProto
+	types    map[string]*dynamicType
+	typeFile map[string]string
+}
+
+func newDescriptorPool() *descriptorPool {
+	return &descriptorPool{
+		files:    make(map[string]*descriptor.FileDescriptorProto),
+		types:    make(map[string]*dynamicType),
+		typeFile: make(map[string]string),
+	}
+}
+
+func (pool *descriptorPool) addFileSet(fileSet *descriptor.FileDescriptorSet) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	for _, file := range fileSet.File {
+		if _, ok := pool.files[file.GetName()]; ok {
+			continue
+		}
+		pool.files[file.GetName()] = file
+
+		prefix := file.GetPackage()
+		if prefix != "" {
+			prefix += "."
+		}
+		for _, msgDesc := range file.MessageType {
+			pool.addMessage(file.GetName(), prefix, msgDesc)
+		}
+	}
+}
+
+func (pool *descriptorPool) addMessage(filename string, prefix string, msgDesc *descriptor.DescriptorProto) {
+	name := prefix + msgDesc.GetName()
+	pool.types[name] = newDynamicType(name, msgDesc, pool)
+	pool.typeFile[name] = filename
+
+	for _, nestedDesc := range msgDesc.NestedType {
+		pool.addMessage(filename, name+".", nestedDesc)
+	}
+}
+
+// Returns the dynamic type for a fully-qualified message name, or nil if the
+// pool does not describe the message
+func (pool *descriptorPool) getType(name string) *dynamicType {
+	if pool == nil {
+		return nil
+	}
+	pool.RLock()
+	defer pool.RUnlock()
+
+	return pool.types[strings.TrimPrefix(name, ".")]
+}
+
+// Adds the file describing the named message type, as well as all of the
+// file's dependencies, to files.  Descriptors compiled into the binary take
+// precedence over those in the pool, and the pool may be nil.  Returns false
+// if the type cannot be described.
+func describeType(name string, pool *descriptorPool, files map[string]*descriptor.FileDescriptorProto) bool {
+	if ptrType := proto.MessageType(name); ptrType != nil {
+		msg, ok := reflect.New(ptrType.Elem()).Interface().(interface {
+			Descriptor() ([]byte, []int)
+		})
+		if ok {
+			gzBytes, _ := msg.Descriptor()
+			if file := unzipFileDescriptor(gzBytes); file != nil {
+				return describeFile(file, pool, files)
+			}
+		}
+	}
+
+	if pool == nil {
+		return false
+	}
+	pool.RLock()
+	filename, ok := pool.typeFile[name]
+	file := pool.files[filename]
+	pool.RUnlock()
+	if !ok {
+		return false
+	}
+	return describeFile(file, pool, files)
+}
+
+func describeFile(file *descriptor.FileDescriptorProto, pool *descriptorPool, files map[string]*descriptor.FileDescriptorProto) bool {
+	if _, ok := files[file.GetName()]; ok {
+		return true
+	}
+	files[file.GetName()] = file
+
+	for _, depName := range file.Dependency {
+		dep := unzipFileDescriptor(proto.FileDescriptor(depName))
+		if dep == nil && pool != nil {
+			pool.RLock()
+			dep = pool.files[depName]
+			pool.RUnlock()
+		}
+		if dep == nil || !describeFile(dep, pool, files) {
+			return false
+		}
+	}
+	return true
+}
+
+func unzipFileDescriptor(gzBytes []byte) *descriptor.FileDescriptorProto {
+	if len(gzBytes) == 0 {
+		return nil
+	}
+	gzReader, err := gzip.NewReader(bytes.NewReader(gzBytes))
+	if err != nil {
+		return nil
+	}
+	defer gzReader.Close()
+	fileBytes, err := ioutil.ReadAll(gzReader)
+	if err != nil {
+		return nil
+	}
+
+	file := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(fileBytes, file); err != nil {
+		return nil
+	}
+	return file
+}
@@ -0,0 +1,158 @@
+package proio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func writeDescribedStream(t *testing.T) []byte {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.EmbedDescriptors = true
+
+	for i := 0; i < 2; i++ {
+		eventOut := NewEvent()
+		MCParticles := &prolcio.MCParticleCollection{}
+		MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: 11})
+		eventOut.Add(MCParticles, "MCParticles")
+		if err := writer.Push(eventOut); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func TestEmbedDescriptors(t *testing.T) {
+	stream := writeDescribedStream(t)
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(writeDescribedStream(t), stream) {
+			t.Fatal("Identical streams were written differently")
+		}
+	}
+
+	reader := NewReader(bytes.NewReader(stream))
+	for i := 0; i < 2; i++ {
+		eventIn, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := eventIn.Get("MCParticles").(*prolcio.MCParticleCollection); !ok {
+			t.Error("Compiled-in type was not used")
+		}
+	}
+
+	fileSet := &descriptor.FileDescriptorSet{}
+	for _, file := range reader.descriptors.files {
+		fileSet.File = append(fileSet.File, file)
+	}
+	if len(fileSet.File) != 2 {
+		t.Errorf("%v files described instead of 2", len(fileSet.File))
+	}
+}
+
+// Writes a stream with a collection type that is not compiled into the test
+// binary by renaming the package of the lcio model in its descriptor
+func writeUnregisteredStream(t *testing.T, MCParticles *prolcio.MCParticleCollection) *bytes.Buffer {
+	files := make(map[string]*descriptor.FileDescriptorProto)
+	if !describeType("proio.model.lcio.MCParticleCollection", nil, files) {
+		t.Fatal("Failed to describe lcio model")
+	}
+	fileSet := &descriptor.FileDescriptorSet{}
+	for _, file := range files {
+		file = proto.Clone(file).(*descriptor.FileDescriptorProto)
+		if file.GetPackage() == "proio.model.lcio" {
+			file.Name = proto.String("unregistered.proto")
+			file.Package = proto.String("proio.model.unregistered")
+			for _, msgDesc := range file.MessageType {
+				for _, field := range msgDesc.Field {
+					typeName := strings.Replace(field.GetTypeName(), ".lcio.", ".unregistered.", 1)
+					field.TypeName = proto.String(typeName)
+				}
+			}
+		}
+		fileSet.File = append(fileSet.File, file)
+	}
+	value, err := proto.Marshal(fileSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	if err := writer.pushMetadata(descriptorsKey, value); err != nil {
+		t.Fatal(err)
+	}
+
+	eventOut := NewEvent()
+	eventOut.Add(MCParticles, "MCParticles")
+	eventOut.flushCollCache()
+	eventOut.Header.PayloadCollections[0].Type = "unregistered.MCParticleCollection"
+	if err := writer.Push(eventOut); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer
+}
+
+func TestDynamicCollection(t *testing.T) {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	part1 := &prolcio.MCParticle{PDG: 11, P: []float64{1, 2, 3}}
+	part2 := &prolcio.MCParticle{PDG: -11, Charge: 1}
+	MCParticles.Entries = append(MCParticles.Entries, part1, part2)
+	part1.Children = append(part1.Children, event.Reference(part2))
+	part2.Parents = append(part2.Parents, event.Reference(part1))
+	collBytes, _ := MCParticles.Marshal()
+
+	reader := NewReader(writeUnregisteredStream(t, MCParticles))
+	eventIn, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coll := eventIn.Get("MCParticles")
+	dynColl, ok := coll.(*DynamicMessage)
+	if !ok {
+		t.Fatalf("Collection is %T instead of *DynamicMessage", coll)
+	}
+	if GetType(dynColl) != "unregistered.MCParticleCollection" {
+		t.Errorf("Wrong collection type %v", GetType(dynColl))
+	}
+	if dynColl.GetId() != MCParticles.GetId() {
+		t.Error("Collection ID mismatch")
+	}
+	if dynColl.GetNEntries() != 2 {
+		t.Fatalf("Collection has %v entries instead of 2", dynColl.GetNEntries())
+	}
+
+	dynBytes, err := dynColl.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dynBytes, collBytes) {
+		t.Error("Dynamic collection did not reserialize verbatim")
+	}
+
+	child := eventIn.Dereference(part1.Children[0])
+	if child != dynColl.GetEntry(1) {
+		t.Error("Failed to dereference dynamic entry")
+	}
+	if !reflect.DeepEqual(eventIn.Reference(child), part1.Children[0]) {
+		t.Error("Failed to reference dynamic entry")
+	}
+
+	text := dynColl.String()
+	for _, expected := range []string{"PDG:11 ", "PDG:-11 ", "p:1 p:2 p:3 ", "charge:1 "} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Text %q does not contain %q", text, expected)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package proio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// dynamicType describes a message type that is known only through its
+// protobuf descriptor
+type dynamicType struct {
+	name   string
+	desc   *descriptor.DescriptorProto
+	pool   *descriptorPool
+	fields map[int32]*descriptor.FieldDescriptorProto
+
+	idNumber      int32
+	entriesNumber int32
+}
+
+func newDynamicType(name string, desc *descriptor.DescriptorProto, pool *descriptorPool) *dynamicType {
+	dynType := &dynamicType{
+		name:   name,
+		desc:   desc,
+		pool:   pool,
+		fields: make(map[int32]*descriptor.FieldDescriptorProto),
+	}
+	for _, field := range desc.Field {
+		dynType.fields[field.GetNumber()] = field
+		switch field.GetName() {
+		case "id":
+			dynType.idNumber = field.GetNumber()
+		case "entries":
+			dynType.entriesNumber = field.GetNumber()
+		}
+	}
+	return dynType
+}
+
+// DynamicMessage is a message decoded directly from the protobuf wire format
+// rather than into a compiled Go type.  Field names and types are taken from
+// protobuf descriptors when they are available (either compiled into the
+// binary or embedded in the stream), and otherwise only field numbers and wire
+// types are known.  DynamicMessage implements both the Message and Collection
+// interfaces, so that collections of unknown types can be retrieved with
+// (*Event) Get(), inspected, referenced and written back out unchanged.  See
+// also (*Event) GetDynamic() and (*DynamicMessage) Fields().
+type DynamicMessage struct {
+	dynType *dynamicType
+	fields  []*dynamicField
+}
+
+// dynamicField is a single occurrence of a field on the wire.  Repeated fields
+// that are not packed occur once per value.
+type dynamicField struct {
+	number   int32
+	wireType int
+	scalar   uint64
+	bytes    []byte
+	msg      *DynamicMessage
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var (
+	ErrWireFormat  = errors.New("invalid protobuf wire format")
+	ErrUnsupported = errors.New("unsupported protobuf wire type")
+)
+
+func newDynamicMessage(dynType *dynamicType) *DynamicMessage {
+	return &DynamicMessage{dynType: dynType}
+}
+
+func (m *DynamicMessage) Reset() {
+	m.fields = nil
+}
+
+func (m *DynamicMessage) ProtoMessage() {}
+
+// Returns the fully-qualified type name of the message.  This allows
+// proto.MessageName() and GetType() to work with dynamic messages.
+func (m *DynamicMessage) XXX_MessageName() string {
+	return m.dynType.name
+}
+
+func (m *DynamicMessage) String() string {
+	buffer := &bytes.Buffer{}
+	m.writeText(buffer)
+	return buffer.String()
+}
+
+func (m *DynamicMessage) writeText(buffer *bytes.Buffer) {
+	for _, field := range m.fields {
+		fieldDesc := m.dynType.fields[field.number]
+		name := strconv.Itoa(int(field.number))
+		if fieldDesc != nil {
+			name = fieldDesc.GetName()
+		}
+
+		for _, value := range field.values(fieldDesc) {
+			if msg, ok := value.(*DynamicMessage); ok {
+				fmt.Fprint(buffer, name, ":<")
+				msg.writeText(buffer)
+				fmt.Fprint(buffer, "> ")
+				continue
+			}
+
+			switch value := value.(type) {
+			case string:
+				fmt.Fprint(buffer, name, ":", strconv.Quote(value), " ")
+			case []byte:
+				fmt.Fprint(buffer, name, ":", strconv.Quote(string(value)), " ")
+			case float32:
+				fmt.Fprint(buffer, name, ":", strconv.FormatFloat(float64(value), 'g', -1, 32), " ")
+			case float64:
+				fmt.Fprint(buffer, name, ":", strconv.FormatFloat(value, 'g', -1, 64), " ")
+			default:
+				fmt.Fprint(buffer, name, ":", value, " ")
+			}
+		}
+	}
+}
+
+func (m *DynamicMessage) Marshal() ([]byte, error) {
+	var buf []byte
+	for _, field := range m.fields {
+		buf = appendVarint(buf, uint64(field.number)<<3|uint64(field.wireType))
+		switch field.wireType {
+		case wireVarint:
+			buf = appendVarint(buf, field.scalar)
+		case wireFixed64:
+			buf = append(buf, make([]byte, 8)...)
+			binary.LittleEndian.PutUint64(buf[len(buf)-8:], field.scalar)
+		case wireFixed32:
+			buf = append(buf, make([]byte, 4)...)
+			binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(field.scalar))
+		case wireBytes:
+			data := field.bytes
+			if field.msg != nil {
+				var err error
+				if data, err = field.msg.Marshal(); err != nil {
+					return nil, err
+				}
+			}
+			buf = appendVarint(buf, uint64(len(data)))
+			buf = append(buf, data...)
+		}
+	}
+	return buf, nil
+}
+
+func (m *DynamicMessage) Unmarshal(buf []byte) error {
+	m.fields = nil
+	// Fields refer into the buffer, which the caller may reuse
+	buf = append([]byte(nil), buf...)
+	for len(buf) > 0 {
+		tag, n := decodeVarint(buf)
+		if n == 0 {
+			return ErrWireFormat
+		}
+		buf = buf[n:]
+
+		field := &dynamicField{
+			number:   int32(tag >> 3),
+			wireType: int(tag & 7),
+		}
+		switch field.wireType {
+		case wireVarint:
+			if field.scalar, n = decodeVarint(buf); n == 0 {
+				return ErrWireFormat
+			}
+		case wireFixed64:
+			if n = 8; len(buf) < n {
+				return ErrWireFormat
+			}
+			field.scalar = binary.LittleEndian.Uint64(buf)
+		case wireFixed32:
+			if n = 4; len(buf) < n {
+				return ErrWireFormat
+			}
+			field.scalar = uint64(binary.LittleEndian.Uint32(buf))
+		case wireBytes:
+			size, sizeLen := decodeVarint(buf)
+			if sizeLen == 0 || uint64(len(buf)-sizeLen) < size {
+				return ErrWireFormat
+			}
+			n = sizeLen + int(size)
+			field.bytes = buf[sizeLen:n]
+
+			fieldDesc := m.dynType.fields[field.number]
+			if fieldDesc != nil && fieldDesc.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+				if msgType := m.dynType.pool.getType(fieldDesc.GetTypeName()); msgType != nil {
+					field.msg = newDynamicMessage(msgType)
+					if err := field.msg.Unmarshal(field.bytes); err != nil {
+						return err
+					}
+					field.bytes = nil
+				}
+			}
+		default:
+			return ErrUnsupported
+		}
+		buf = buf[n:]
+
+		m.fields = append(m.fields, field)
+	}
+	return nil
+}
+
+func (m *DynamicMessage) GetId() uint32 {
+	if m.dynType.idNumber == 0 {
+		return 0
+	}
+	for _, field := range m.fields {
+		if field.number == m.dynType.idNumber {
+			return uint32(field.scalar)
+		}
+	}
+	return 0
+}
+
+func (m *DynamicMessage) SetId(id uint32) {
+	if m.dynType.idNumber == 0 {
+		return
+	}
+	for i, field := range m.fields {
+		if field.number == m.dynType.idNumber {
+			if id == 0 {
+				m.fields = append(m.fields[:i], m.fields[i+1:]...)
+			} else {
+				field.scalar = uint64(id)
+			}
+			return
+		}
+	}
+	if id != 0 {
+		idField := &dynamicField{
+			number:   m.dynType.idNumber,
+			wireType: wireVarint,
+			scalar:   uint64(id),
+		}
+		m.fields = append([]*dynamicField{idField}, m.fields...)
+	}
+}
+
+// Returns a deep copy of the message
+func (m *DynamicMessage) clone() *DynamicMessage {
+	clone := newDynamicMessage(m.dynType)
+	for _, field := range m.fields {
+		fieldClone := *field
+		if field.bytes != nil {
+			fieldClone.bytes = append([]byte(nil), field.bytes...)
+		}
+		if field.msg != nil {
+			fieldClone.msg = field.msg.clone()
+		}
+		clone.fields = append(clone.fields, &fieldClone)
+	}
+	return clone
+}
+
+func (m *DynamicMessage) GetNEntries() uint32 {
+	nEntries := uint32(0)
+	for _, field := range m.fields {
+		if field.number == m.dynType.entriesNumber && field.msg != nil {
+			nEntries++
+		}
+	}
+	return nEntries
+}
+
+func (m *DynamicMessage) GetEntry(i uint32) proto.Message {
+	if m.dynType.entriesNumber == 0 {
+		return nil
+	}
+	for _, field := range m.fields {
+		if field.number == m.dynType.entriesNumber && field.msg != nil {
+			if i == 0 {
+				return field.msg
+			}
+			i--
+		}
+	}
+	return nil
+}
+
+// Decodes the values held by a field occurrence according to its descriptor.
+// Packed repeated fields yield more than one value.  If the descriptor is nil,
+// the raw wire value is returned.
+func (field *dynamicField) values(fieldDesc *descriptor.FieldDescriptorProto) []interface{} {
+	if field.msg != nil {
+		return []interface{}{field.msg}
+	}
+	if fieldDesc == nil {
+		if field.wireType == wireBytes {
+			return []interface{}{field.bytes}
+		}
+		return []interface{}{field.scalar}
+	}
+
+	fieldType := fieldDesc.GetType()
+	switch fieldType {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return []interface{}{string(field.bytes)}
+	case descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		return []interface{}{field.bytes}
+	}
+
+	if field.wireType != wireBytes {
+		return []interface{}{scalarValue(fieldType, field.scalar)}
+	}
+
+	// packed repeated scalars
+	var values []interface{}
+	buf := field.bytes
+	for len(buf) > 0 {
+		var scalar uint64
+		switch fieldType {
+		case descriptor.FieldDescriptorProto_TYPE_DOUBLE,
+			descriptor.FieldDescriptorProto_TYPE_FIXED64,
+			descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+			if len(buf) < 8 {
+				return values
+			}
+			scalar = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case descriptor.FieldDescriptorProto_TYPE_FLOAT,
+			descriptor.FieldDescriptorProto_TYPE_FIXED32,
+			descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+			if len(buf) < 4 {
+				return values
+			}
+			scalar = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		default:
+			var n int
+			if scalar, n = decodeVarint(buf); n == 0 {
+				return values
+			}
+			buf = buf[n:]
+		}
+		values = append(values, scalarValue(fieldType, scalar))
+	}
+	return values
+}
+
+func scalarValue(fieldType descriptor.FieldDescriptorProto_Type, scalar uint64) interface{} {
+	switch fieldType {
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return math.Float64frombits(scalar)
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return math.Float32frombits(uint32(scalar))
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(scalar)
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return int32(scalar)
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(scalar)
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return scalar != 0
+	case descriptor.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(scalar)>>1) ^ -int32(scalar&1)
+	case descriptor.FieldDescriptorProto_TYPE_SINT64:
+		return int64(scalar>>1) ^ -int64(scalar&1)
+	}
+	return scalar
+}
+
+func decodeVarint(buf []byte) (uint64, int) {
+	value := uint64(0)
+	for i := 0; i < len(buf) && i < 10; i++ {
+		value |= uint64(buf[i]&0x7f) << (7 * uint(i))
+		if buf[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func appendVarint(buf []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buf = append(buf, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buf, byte(value))
+}
+
+// Kind describes how the values of a DynamicField are represented in Go.
+// Fields without descriptors have one of the wire kinds (VarintKind,
+// Fixed32Kind, Fixed64Kind or BytesKind).
+type Kind int
+
+const (
+	InvalidKind Kind = iota
+	BoolKind
+	Int32Kind
+	Int64Kind
+	Uint32Kind
+	Uint64Kind
+	FloatKind
+	DoubleKind
+	EnumKind
+	StringKind
+	BytesKind
+	MessageKind
+	VarintKind
+	Fixed32Kind
+	Fixed64Kind
+)
+
+var kindNames = [...]string{
+	InvalidKind: "invalid",
+	BoolKind:    "bool",
+	Int32Kind:   "int32",
+	Int64Kind:   "int64",
+	Uint32Kind:  "uint32",
+	Uint64Kind:  "uint64",
+	FloatKind:   "float",
+	DoubleKind:  "double",
+	EnumKind:    "enum",
+	StringKind:  "string",
+	BytesKind:   "bytes",
+	MessageKind: "message",
+	VarintKind:  "varint",
+	Fixed32Kind: "fixed32",
+	Fixed64Kind: "fixed64",
+}
+
+func (kind Kind) String() string {
+	if kind < 0 || int(kind) >= len(kindNames) {
+		return "Kind(" + strconv.Itoa(int(kind)) + ")"
+	}
+	return kindNames[kind]
+}
+
+// DynamicField is a field of a DynamicMessage, with all occurrences of the
+// field number on the wire merged together.  Values holds one element per
+// value, with the Go type determined by Kind: bool, int32, int64, uint32,
+// uint64, float32, float64, string, []byte or *DynamicMessage.  Wire kinds are
+// represented as uint64 (VarintKind and Fixed64Kind), uint32 (Fixed32Kind) and
+// []byte (BytesKind).  Name is empty if the field is not described.
+type DynamicField struct {
+	Name     string
+	Number   int32
+	Kind     Kind
+	Repeated bool
+	Values   []interface{}
+}
+
+// Returns the value of a singular field.  As with protobuf, the last value
+// wins if the field occurs more than once.
+func (field *DynamicField) Value() interface{} {
+	if len(field.Values) == 0 {
+		return nil
+	}
+	return field.Values[len(field.Values)-1]
+}
+
+// Returns the nested messages held by the field.  For BytesKind fields, an
+// attempt is made to decode the values as messages without a schema, and nil
+// is returned if any of them is not a valid message.
+func (field *DynamicField) Messages() []*DynamicMessage {
+	var msgs []*DynamicMessage
+	for _, value := range field.Values {
+		switch value := value.(type) {
+		case *DynamicMessage:
+			msgs = append(msgs, value)
+		case []byte:
+			msg := newDynamicMessage(schemalessType(""))
+			if err := msg.Unmarshal(value); err != nil {
+				return nil
+			}
+			msgs = append(msgs, msg)
+		default:
+			return nil
+		}
+	}
+	return msgs
+}
+
+// Returns the nested message held by a singular field, or nil.  See
+// (*DynamicField) Messages().
+func (field *DynamicField) Message() *DynamicMessage {
+	msgs := field.Messages()
+	if len(msgs) == 0 {
+		return nil
+	}
+	return msgs[len(msgs)-1]
+}
+
+// Returns the fields of the message in order of first appearance on the wire
+func (m *DynamicMessage) Fields() []*DynamicField {
+	var fields []*DynamicField
+	byNumber := make(map[int32]*DynamicField)
+	for _, wireField := range m.fields {
+		field := byNumber[wireField.number]
+		fieldDesc := m.dynType.fields[wireField.number]
+		if field == nil {
+			field = &DynamicField{
+				Number: wireField.number,
+				Kind:   wireKind(wireField.wireType),
+			}
+			if fieldDesc != nil {
+				field.Name = fieldDesc.GetName()
+				field.Kind = descriptorKind(fieldDesc.GetType())
+				field.Repeated = fieldDesc.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED
+			}
+			byNumber[field.Number] = field
+			fields = append(fields, field)
+		} else if fieldDesc == nil {
+			field.Repeated = true
+		}
+
+		field.Values = append(field.Values, wireField.values(fieldDesc)...)
+	}
+	return fields
+}
+
+// Returns the field with the given name, or nil if it is not present
+func (m *DynamicMessage) FieldByName(name string) *DynamicField {
+	for _, field := range m.Fields() {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// Returns the field with the given number, or nil if it is not present
+func (m *DynamicMessage) FieldByNumber(number int32) *DynamicField {
+	for _, field := range m.Fields() {
+		if field.Number == number {
+			return field
+		}
+	}
+	return nil
+}
+
+// Walk calls visit for every field of the message, descending depth-first into
+// nested messages after visiting the field that holds them.  The path holds the
+// fields enclosing the visited field.  Walking stops at the first error
+// returned by visit, and that error is returned.
+func (m *DynamicMessage) Walk(visit func(path []*DynamicField, field *DynamicField) error) error {
+	return m.walk(nil, visit)
+}
+
+func (m *DynamicMessage) walk(path []*DynamicField, visit func([]*DynamicField, *DynamicField) error) error {
+	for _, field := range m.Fields() {
+		if err := visit(path, field); err != nil {
+			return err
+		}
+		if field.Kind != MessageKind {
+			continue
+		}
+		for _, msg := range field.Messages() {
+			if err := msg.walk(append(path, field), visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func wireKind(wireType int) Kind {
+	switch wireType {
+	case wireVarint:
+		return VarintKind
+	case wireFixed64:
+		return Fixed64Kind
+	case wireFixed32:
+		return Fixed32Kind
+	case wireBytes:
+		return BytesKind
+	}
+	return InvalidKind
+}
+
+func descriptorKind(fieldType descriptor.FieldDescriptorProto_Type) Kind {
+	switch fieldType {
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return BoolKind
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SINT32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return Int32Kind
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SINT64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return Int64Kind
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return Uint32Kind
+	case descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		return Uint64Kind
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return FloatKind
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return DoubleKind
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return EnumKind
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return StringKind
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return BytesKind
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return MessageKind
+	}
+	return InvalidKind
+}
+
+// Returns a type with no descriptor, for decoding messages without a schema
+func schemalessType(name string) *dynamicType {
+	return newDynamicType(name, &descriptor.DescriptorProto{}, nil)
+}
+
+var compiledDescriptors = newDescriptorPool()
+
+// Returns the dynamic type for a fully-qualified message name.  Descriptors in
+// the pool take precedence, followed by descriptors compiled into the binary.
+// If neither describes the type, a schema-less type is returned.
+func lookupDynamicType(name string, pool *descriptorPool) *dynamicType {
+	if dynType := pool.getType(name); dynType != nil {
+		return dynType
+	}
+
+	if dynType := compiledDescriptors.getType(name); dynType != nil {
+		return dynType
+	}
+	files := make(map[string]*descriptor.FileDescriptorProto)
+	if describeType(name, nil, files) {
+		fileSet := &descriptor.FileDescriptorSet{}
+		for _, file := range files {
+			fileSet.File = append(fileSet.File, file)
+		}
+		compiledDescriptors.addFileSet(fileSet)
+		if dynType := compiledDescriptors.getType(name); dynType != nil {
+			return dynType
+		}
+	}
+
+	return schemalessType(name)
+}
@@ -0,0 +1,99 @@
+package proio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func TestGetDynamic(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+
+	eventOut := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	eventOut.Add(MCParticles, "MCParticles")
+	part1 := &prolcio.MCParticle{PDG: 11, P: []float64{1, 2, 3}}
+	part2 := &prolcio.MCParticle{PDG: -11}
+	MCParticles.Entries = append(MCParticles.Entries, part1, part2)
+	part1.Children = append(part1.Children, eventOut.Reference(part2))
+	writer.Push(eventOut)
+
+	reader := NewReader(buffer)
+	eventIn, _ := reader.Get()
+
+	msg := eventIn.GetDynamic("MCParticles")
+	if msg == nil {
+		t.Fatal("Failed to get dynamic collection")
+	}
+	if len(eventIn.Header.PayloadCollections) != 1 {
+		t.Error("GetDynamic modified the event")
+	}
+
+	entries := msg.FieldByName("entries")
+	if entries == nil || entries.Kind != MessageKind || !entries.Repeated {
+		t.Fatal("Bad entries field")
+	}
+	parts := entries.Messages()
+	if len(parts) != 2 {
+		t.Fatalf("%v entries instead of 2", len(parts))
+	}
+	if pdg := parts[1].FieldByName("PDG"); pdg == nil || pdg.Kind != Int32Kind || pdg.Value() != int32(-11) {
+		t.Errorf("Bad PDG field %v", pdg)
+	}
+	if p := parts[0].FieldByName("p"); p == nil || !reflect.DeepEqual(p.Values, []interface{}{1.0, 2.0, 3.0}) {
+		t.Errorf("Bad p field %v", p)
+	}
+	child := parts[0].FieldByName("children").Message()
+	if child.FieldByName("entryID").Value() != part1.Children[0].EntryID {
+		t.Error("Bad reference in children field")
+	}
+
+	var nPDG int
+	msg.Walk(func(path []*DynamicField, field *DynamicField) error {
+		if field.Name == "PDG" && len(path) == 1 && path[0].Name == "entries" {
+			nPDG++
+		}
+		return nil
+	})
+	if nPDG != 2 {
+		t.Errorf("Walk visited %v PDG fields instead of 2", nPDG)
+	}
+}
+
+func TestGetDynamicSchemaless(t *testing.T) {
+	eventOut := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{Id: 3}
+	MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{Id: 4, PDG: 22})
+	eventOut.Add(MCParticles, "MCParticles")
+	eventOut.flushCollCache()
+	eventOut.Header.PayloadCollections[0].Type = "unknown.ThingCollection"
+
+	msg := eventOut.GetDynamic("MCParticles")
+	if msg == nil {
+		t.Fatal("Failed to get schema-less collection")
+	}
+	if GetType(msg) != "unknown.ThingCollection" {
+		t.Errorf("Wrong type %v", GetType(msg))
+	}
+
+	fields := msg.Fields()
+	if len(fields) != 2 {
+		t.Fatalf("%v fields instead of 2", len(fields))
+	}
+	if fields[0].Number != 1 || fields[0].Kind != VarintKind || fields[0].Value() != uint64(3) {
+		t.Errorf("Bad id field %v", fields[0])
+	}
+	if fields[1].Number != 4 || fields[1].Kind != BytesKind || fields[1].Name != "" {
+		t.Errorf("Bad entries field %v", fields[1])
+	}
+	entry := fields[1].Message()
+	if entry == nil {
+		t.Fatal("Failed to decode schema-less entry")
+	}
+	if pdg := entry.FieldByNumber(4); pdg == nil || pdg.Value() != uint64(22) {
+		t.Errorf("Bad PDG field %v", pdg)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"log"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/decibelcooper/proio/go-proio/model"
@@ -14,11 +16,34 @@ import (
 // Struct representing an event either created with NewEvent() or retrieved
 // with (*Reader) Next()
 type Event struct {
-	Header  *model.EventHeader
-	payload []byte
+	Header *model.EventHeader
+
+	// If Logger is set, errors that are not returned by methods such as
+	// Get() and Dereference() are logged to it.  Events read by a Reader
+	// inherit the Reader's Logger.
+	Logger *log.Logger
+
+	// If ReadOnly is true, Get() decodes collections without removing their
+	// bytes from the payload, so that collections that are only read are
+	// written back out verbatim by (*Writer) Push(), in their original order.
+	// Collections returned by Get() must then not be modified unless they are
+	// first marked with MarkDirty().  Events read by a Reader inherit the
+	// Reader's ReadOnly setting.
+	ReadOnly bool
+
+	// Metadata holds the stream metadata (see (*Writer) PushMetadata()) in
+	// effect where the event was read.  The map may be shared with other
+	// events, and must not be modified.
+	Metadata map[string][]byte
+
+	payload       []byte
+	sharedPayload bool
 
 	collCache   map[string]Collection
-	namesCached []string
+	viewCache   map[string]Collection
+	order       []string
+	descriptors *descriptorPool
+	refs        *refIndex
 }
 
 // Returns a new event with minimal initialization
@@ -29,18 +54,90 @@ func NewEvent() *Event {
 	}
 }
 
-// Get a list of collection names in the event
+// Get a list of collection names in the event.  Collections are listed in
+// the order in which they were added, or in which they were stored in the
+// stream, unless rearranged with MoveCollection() or SortCollections().
+// Collections are serialized in this order by (*Writer) Push(), regardless of
+// which ones have been retrieved with Get().
 func (evt *Event) GetNames() []string {
-	names := make([]string, 0)
+	return append([]string(nil), evt.names()...)
+}
+
+// Moves a collection to the given position in the order returned by
+// GetNames().  Positions beyond the ends are clamped to the first or last
+// position.
+func (evt *Event) MoveCollection(name string, index int) error {
+	order := evt.names()
+	from := -1
+	for i, orderName := range order {
+		if orderName == name {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return ErrNoSuchCollection
+	}
+	if index < 0 {
+		index = 0
+	} else if index >= len(order) {
+		index = len(order) - 1
+	}
 
+	if from < index {
+		copy(order[from:index], order[from+1:index+1])
+	} else {
+		copy(order[index+1:from+1], order[index:from])
+	}
+	order[index] = name
+	return nil
+}
+
+// Sorts the collections of the event, i.e. the order returned by GetNames().
+// If less is nil, collections are sorted by name.  The sort is stable.
+func (evt *Event) SortCollections(less func(name1, name2 string) bool) {
+	order := evt.names()
+	if less == nil {
+		less = func(name1, name2 string) bool { return name1 < name2 }
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(order[i], order[j])
+	})
+}
+
+// Returns the order of collections, bringing it up to date with the header
+// and the cache
+func (evt *Event) names() []string {
+	present := make(map[string]bool)
 	for _, collHdr := range evt.Header.PayloadCollections {
-		names = append(names, collHdr.Name)
+		present[collHdr.Name] = true
 	}
 	for name := range evt.collCache {
-		names = append(names, name)
+		present[name] = true
 	}
 
-	return names
+	order := evt.order[:0]
+	for _, name := range evt.order {
+		if present[name] {
+			order = append(order, name)
+			delete(present, name)
+		}
+	}
+	// Collections that were placed in the header directly
+	for _, collHdr := range evt.Header.PayloadCollections {
+		if present[collHdr.Name] {
+			order = append(order, collHdr.Name)
+			delete(present, collHdr.Name)
+		}
+	}
+	var missing []string
+	for name := range present {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	evt.order = append(order, missing...)
+
+	return evt.order
 }
 
 // Get a string representing the collection type
@@ -49,8 +146,11 @@ func GetType(coll Collection) string {
 }
 
 var (
-	ErrDupCollection = errors.New("duplicate collection name")
-	ErrDupID         = errors.New("duplicate collection id")
+	ErrDupCollection     = errors.New("duplicate collection name")
+	ErrDupID             = errors.New("duplicate collection id")
+	ErrNoSuchCollection  = errors.New("no collection with this name in the event")
+	ErrUnknownType       = errors.New("collection type is neither compiled in nor described in the stream")
+	ErrCorruptCollection = errors.New("collection cannot be unmarshaled")
 )
 
 // Add a collection to the event.  This allows automatic referencing with
@@ -76,16 +176,24 @@ func (evt *Event) Add(coll Collection, name string) error {
 		}
 	}
 
+	evt.order = append(evt.names(), name)
 	evt.collCache[name] = coll
-	evt.namesCached = append(evt.namesCached, name)
+	if evt.refs != nil {
+		evt.refs.index(coll)
+	}
 	return nil
 }
 
 // Remove a collection from the event by name
 func (evt *Event) Remove(name string) {
+	if _, ok := evt.viewCache[name]; ok {
+		delete(evt.viewCache, name)
+		evt.refs = nil
+	}
 	for key := range evt.collCache {
 		if key == name {
 			delete(evt.collCache, key)
+			evt.refs = nil
 			return
 		}
 	}
@@ -97,18 +205,118 @@ func (evt *Event) Remove(name string) {
 	}
 }
 
+// Returns the type of a collection that is still serialized in the payload,
+// or an empty string if there is no such collection
+func (evt *Event) payloadType(name string) string {
+	for _, collHdr := range evt.Header.PayloadCollections {
+		if collHdr.Name == name {
+			return collHdr.Type
+		}
+	}
+	return ""
+}
+
 // Gets a collection from the event.  The collection is deserialized upon the
 // first time calling this function.  Once deserialized, the collection is
 // removed from Header.PayloadCollection, and placed back into a queue for
 // reserialization.  The event may be safely modified before reserializing.
+// For ReadOnly events, the collection is instead left in the payload.
+// If the collection type is not compiled into the binary, but descriptors for
+// it were embedded in the stream (see Writer.EmbedDescriptors), the collection
+// is returned as a *DynamicMessage.  Nil is returned if the collection does
+// not exist or cannot be decoded, in which case the cause is logged to the
+// event's Logger.  See also (*Event) GetE().
 func (evt *Event) Get(name string) Collection {
+	coll, err := evt.GetE(name)
+	if err != nil && err != ErrNoSuchCollection {
+		evt.logf("failed to get collection %v: %v", name, err)
+	}
+	return coll
+}
+
+// GetE is like Get(), except that it returns ErrNoSuchCollection if the event
+// has no collection of the given name, ErrUnknownType if the type of the
+// collection can be neither found in the binary nor in descriptors embedded in
+// the stream, and ErrCorruptCollection if the collection cannot be
+// unmarshaled.  A collection that fails to decode is left in the payload.
+func (evt *Event) GetE(name string) (Collection, error) {
 	if msg := evt.collCache[name]; msg != nil {
-		return msg
+		return msg, nil
+	}
+	if msg := evt.viewCache[name]; msg != nil {
+		return msg, nil
 	}
 
 	return evt.getFromPayload(name, true)
 }
 
+// MarkDirty queues a collection that was retrieved with Get() from a ReadOnly
+// event for reserialization, so that changes made to it are written out.  The
+// collection's original bytes are dropped from the payload.  Collections that
+// have not been decoded are left alone.
+func (evt *Event) MarkDirty(name string) {
+	coll := evt.viewCache[name]
+	if coll == nil {
+		return
+	}
+	delete(evt.viewCache, name)
+	evt.names()
+	evt.getFromPayload(name, false)
+
+	evt.collCache[name] = coll
+}
+
+// Marks the collection holding a message dirty, since the message is about to
+// be modified
+func (evt *Event) touch(coll Collection) {
+	for name, viewColl := range evt.viewCache {
+		if viewColl == coll {
+			evt.MarkDirty(name)
+			return
+		}
+	}
+}
+
+// Decodes a collection directly from the protobuf wire format, without
+// requiring its type to be compiled into the binary.  Field names and types are
+// filled in from descriptors embedded in the stream or compiled into the
+// binary when available.  Unlike Get(), the event is left untouched: the
+// returned message is a snapshot, and changes to it are not written out.  Nil
+// is returned if the collection does not exist or cannot be decoded.
+func (evt *Event) GetDynamic(name string) *DynamicMessage {
+	var collType string
+	var collBuf []byte
+	if coll := evt.collCache[name]; coll != nil {
+		var err error
+		if collBuf, err = coll.Marshal(); err != nil {
+			return nil
+		}
+		collType = GetType(coll)
+	} else {
+		offset := uint32(0)
+		for _, collHdr := range evt.Header.PayloadCollections {
+			if collHdr.Name == name {
+				if uint64(offset)+uint64(collHdr.PayloadSize) > uint64(len(evt.payload)) {
+					return nil
+				}
+				collType = collHdr.Type
+				collBuf = evt.payload[offset : offset+collHdr.PayloadSize]
+				break
+			}
+			offset += collHdr.PayloadSize
+		}
+		if collType == "" {
+			return nil
+		}
+	}
+
+	msg := newDynamicMessage(lookupDynamicType("proio.model."+collType, evt.descriptors))
+	if err := msg.Unmarshal(collBuf); err != nil {
+		return nil
+	}
+	return msg
+}
+
 // Get a unique ID for referencing collections or entries.  This is typically
 // not needed, and instead (*Event) Reference() should be called.
 func (evt *Event) GetUniqueID() uint32 {
@@ -121,81 +329,235 @@ func (evt *Event) GetUniqueID() uint32 {
 // have been added to the event, or it must be a collection retrieved with
 // (*Event) Get().
 func (evt *Event) Reference(msg Message) *model.Reference {
-	for _, coll := range evt.collCache {
-		if coll == msg {
-			collID := coll.GetId()
-			if collID == 0 {
-				collID = evt.GetUniqueID()
-				coll.SetId(collID)
-			}
-			return &model.Reference{
-				CollID:  collID,
-				EntryID: 0,
-			}
-		}
+	coll := evt.collectionOf(msg)
+	if coll == nil {
+		return nil
+	}
 
-		for i := uint32(0); i < coll.GetNEntries(); i++ {
-			entry := coll.GetEntry(i).(Message)
-			if entry == msg {
-				collID := coll.GetId()
-				if collID == 0 {
-					collID = evt.GetUniqueID()
-					coll.SetId(collID)
-				}
-				entryID := entry.GetId()
-				if entryID == 0 {
-					entryID = evt.GetUniqueID()
-					entry.SetId(entryID)
-				}
-				return &model.Reference{
-					CollID:  collID,
-					EntryID: entryID,
-				}
-			}
+	collID := coll.GetId()
+	if collID == 0 {
+		evt.touch(coll)
+		collID = evt.GetUniqueID()
+		coll.SetId(collID)
+		evt.refs.reindex(coll)
+	}
+	if msg == coll {
+		return &model.Reference{
+			CollID:  collID,
+			EntryID: 0,
 		}
 	}
 
-	return nil
+	entryID := msg.GetId()
+	if entryID == 0 {
+		evt.touch(coll)
+		entryID = evt.GetUniqueID()
+		msg.SetId(entryID)
+		if evt.refs != nil {
+			evt.refs.byID[refKey{collID, entryID}] = msg
+		}
+	}
+	return &model.Reference{
+		CollID:  collID,
+		EntryID: entryID,
+	}
 }
 
 // Dereference a message from the event.  This returns a message (either
 // collection or collection entry) referred to by a Reference.  The message
-// must exist in the event.
+// must exist in the event, and nil is returned otherwise.  See also
+// (*Event) DereferenceE().
 func (evt *Event) Dereference(ref *model.Reference) Message {
-	var refColl Collection
-	for _, coll := range evt.collCache {
-		if coll.GetId() == ref.CollID {
-			if ref.EntryID == 0 {
-				return coll
+	msg, err := evt.DereferenceE(ref)
+	if err != nil && err != ErrDanglingRef {
+		evt.logf("failed to dereference %v: %v", ref, err)
+	}
+	return msg
+}
+
+// DereferenceE is like Dereference(), except that it returns ErrDanglingRef if
+// the referenced message is not in the event, or the error from GetE() if the
+// referenced collection cannot be decoded.
+func (evt *Event) DereferenceE(ref *model.Reference) (Message, error) {
+	key := refKey{ref.CollID, ref.EntryID}
+	id := ref.EntryID
+	if id == 0 {
+		id = ref.CollID
+	}
+	if msg := evt.refIndex().byID[key]; msg != nil {
+		if msg.GetId() == id && evt.refs.holds(msg) {
+			return msg, nil
+		}
+		// IDs have been changed or entries replaced since the index was
+		// built
+		evt.refs = nil
+	}
+
+	// The referenced collection may still be serialized in the payload, or
+	// entries may have been added since the index was built
+	for _, collHdr := range evt.Header.PayloadCollections {
+		if collHdr.Id == ref.CollID {
+			if _, err := evt.GetE(collHdr.Name); err != nil {
+				return nil, err
 			}
-			refColl = coll
 			break
 		}
 	}
-	if refColl == nil {
-		for _, collHdr := range evt.Header.PayloadCollections {
-			if collHdr.Id == ref.CollID {
-				if refColl = evt.Get(collHdr.Name); refColl == nil {
-					return nil
-				}
-				if ref.EntryID == 0 {
-					return refColl
-				}
-				break
+	if msg := evt.updateRefIndex().byID[key]; msg != nil && evt.refs.holds(msg) {
+		return msg, nil
+	}
+
+	// Entries of the referenced collection may have been replaced in place,
+	// which only a full index can tell
+	for _, coll := range evt.cachedCollections() {
+		if coll.GetId() == ref.CollID {
+			evt.refs = nil
+			if msg := evt.refIndex().byID[key]; msg != nil {
+				return msg, nil
 			}
+			break
 		}
 	}
-	if refColl == nil {
-		return nil
+	return nil, ErrDanglingRef
+}
+
+// Returns the cached collection that holds a message, which may be the
+// collection itself, or nil if there is none
+func (evt *Event) collectionOf(msg Message) Collection {
+	refs := evt.refIndex()
+	if _, ok := refs.byMsg[msg]; !ok {
+		// Entries may have been added since the index was built
+		refs = evt.updateRefIndex()
+	}
+	if pos, ok := refs.byMsg[msg]; ok && refs.holds(msg) {
+		return pos.coll
 	}
 
-	for i := uint32(0); i < refColl.GetNEntries(); i++ {
-		entry := refColl.GetEntry(i).(Message)
-		if entry.GetId() == ref.EntryID {
-			return entry
+	// Entries may have been replaced or removed since the index was built
+	evt.refs = nil
+	return evt.refIndex().byMsg[msg].coll
+}
+
+// Returns all collections that have been decoded
+func (evt *Event) cachedCollections() []Collection {
+	colls := make([]Collection, 0, len(evt.collCache)+len(evt.viewCache))
+	for _, coll := range evt.collCache {
+		colls = append(colls, coll)
+	}
+	for _, coll := range evt.viewCache {
+		colls = append(colls, coll)
+	}
+	return colls
+}
+
+func (evt *Event) logf(format string, args ...interface{}) {
+	if evt.Logger != nil {
+		evt.Logger.Printf(format, args...)
+	}
+}
+
+type refKey struct {
+	collID  uint32
+	entryID uint32
+}
+
+// refIndex maps IDs to the messages of cached collections, and messages back
+// to their collections, making Reference() and Dereference() constant time.
+// It is built lazily, and extended as collections are cached.  Entries
+// appended to collections are indexed on the next lookup that misses.  Since
+// entries may also be replaced or removed in place, hits are checked against
+// the positions the entries were indexed at, and the index is built again on
+// a mismatch, or on a miss that the appended entries do not explain.  The
+// index is dropped whenever collections leave the cache.
+type refIndex struct {
+	byID  map[refKey]Message
+	byMsg map[Message]refPos
+	// Number of entries of each collection that have been indexed
+	nIndexed map[Collection]uint32
+}
+
+// The collection that holds an indexed message, and the position of the
+// message within it
+type refPos struct {
+	coll  Collection
+	entry uint32
+}
+
+func (evt *Event) refIndex() *refIndex {
+	if evt.refs != nil {
+		return evt.refs
+	}
+
+	refs := &refIndex{
+		byID:     make(map[refKey]Message),
+		byMsg:    make(map[Message]refPos),
+		nIndexed: make(map[Collection]uint32),
+	}
+	for _, coll := range evt.cachedCollections() {
+		refs.index(coll)
+	}
+	evt.refs = refs
+
+	return refs
+}
+
+// Indexes the entries that have been appended to cached collections since
+// they were last indexed
+func (evt *Event) updateRefIndex() *refIndex {
+	if evt.refs == nil {
+		return evt.refIndex()
+	}
+
+	refs := evt.refs
+	for _, coll := range evt.cachedCollections() {
+		if nIndexed, ok := refs.nIndexed[coll]; !ok || nIndexed != coll.GetNEntries() {
+			refs.index(coll)
 		}
 	}
-	return nil
+	return refs
+}
+
+// Indexes a collection and those of its entries that have not been indexed
+func (refs *refIndex) index(coll Collection) {
+	collID := coll.GetId()
+	refs.byMsg[coll] = refPos{coll: coll}
+	if collID != 0 {
+		refs.byID[refKey{collID, 0}] = coll
+	}
+
+	nEntries := coll.GetNEntries()
+	for i := refs.nIndexed[coll]; i < nEntries; i++ {
+		entry, ok := coll.GetEntry(i).(Message)
+		if !ok {
+			continue
+		}
+		refs.byMsg[entry] = refPos{coll, i}
+		if entryID := entry.GetId(); collID != 0 && entryID != 0 {
+			refs.byID[refKey{collID, entryID}] = entry
+		}
+	}
+	refs.nIndexed[coll] = nEntries
+}
+
+// Reports whether an indexed message is still where it was indexed
+func (refs *refIndex) holds(msg Message) bool {
+	pos, ok := refs.byMsg[msg]
+	if !ok {
+		return false
+	}
+	if msg == pos.coll {
+		return true
+	}
+	return pos.entry < pos.coll.GetNEntries() && pos.coll.GetEntry(pos.entry) == msg
+}
+
+// Indexes all entries of a collection again, e.g. after its ID has changed
+func (refs *refIndex) reindex(coll Collection) {
+	if refs == nil {
+		return
+	}
+	delete(refs.nIndexed, coll)
+	refs.index(coll)
 }
 
 func (evt *Event) String() string {
@@ -207,7 +569,12 @@ func (evt *Event) String() string {
 	fmt.Fprint(buffer, stringBuf, "\n")
 
 	for _, name := range evt.GetNames() {
-		coll := evt.Get(name)
+		coll, _ := evt.GetE(name)
+		if coll == nil {
+			if msg := evt.GetDynamic(name); msg != nil {
+				coll = msg
+			}
+		}
 		if coll != nil {
 			fmt.Fprint(buffer, "    name:", name, " type:", GetType(coll), "\n")
 
@@ -221,61 +588,162 @@ func (evt *Event) String() string {
 	return string(buffer.Bytes())
 }
 
-func (evt *Event) getFromPayload(name string, unmarshal bool) Collection {
-	offset := uint32(0)
-	size := uint32(0)
-	collType := ""
-	collIndex := 0
-	var collHdr *model.EventHeader_CollectionHeader
-	for collIndex, collHdr = range evt.Header.PayloadCollections {
-		if collHdr.Name == name {
-			collType = collHdr.Type
-			size = collHdr.PayloadSize
-			break
-		}
-		offset += collHdr.PayloadSize
-	}
-	if collType == "" {
-		return nil
+func (evt *Event) getFromPayload(name string, unmarshal bool) (Collection, error) {
+	collIndex, offset, size, err := evt.locateInPayload(name)
+	if err != nil {
+		return nil, err
 	}
 
 	var coll Collection
 	if unmarshal {
-		typeName := "proio.model." + collType
-		ptrType := proto.MessageType(typeName)
-		if ptrType == nil {
-			fmt.Println("failed to get type for", typeName)
-			return nil
+		collType := evt.Header.PayloadCollections[collIndex].Type
+		if coll, err = evt.unmarshalCollection(collType, evt.payload[offset:offset+size]); err != nil {
+			return nil, err
 		}
-		msgType := ptrType.Elem()
-		coll = reflect.New(msgType).Interface().(Collection)
-		if err := coll.Unmarshal(evt.payload[offset : offset+size]); err != nil {
-			fmt.Println("failed to unmarshal")
-			return nil
+
+		if evt.ReadOnly {
+			if evt.viewCache == nil {
+				evt.viewCache = make(map[string]Collection)
+			}
+			evt.viewCache[name] = coll
+			if evt.refs != nil {
+				evt.refs.index(coll)
+			}
+			return coll, nil
 		}
 
+		evt.names()
 		evt.collCache[name] = coll
-		evt.namesCached = append(evt.namesCached, name)
+		if evt.refs != nil {
+			evt.refs.index(coll)
+		}
 	}
 
 	evt.Header.PayloadCollections = append(evt.Header.PayloadCollections[:collIndex], evt.Header.PayloadCollections[collIndex+1:]...)
-	evt.payload = append(evt.payload[:offset], evt.payload[offset+size:]...)
+	if evt.sharedPayload {
+		// The payload belongs to a mapped file
+		payload := make([]byte, 0, len(evt.payload)-int(size))
+		payload = append(payload, evt.payload[:offset]...)
+		evt.payload = append(payload, evt.payload[offset+size:]...)
+		evt.sharedPayload = false
+	} else {
+		evt.payload = append(evt.payload[:offset], evt.payload[offset+size:]...)
+	}
 
-	return coll
+	return coll, nil
+}
+
+// Finds a collection in the payload, returning the index of its header and its
+// offset and size in the payload
+func (evt *Event) locateInPayload(name string) (int, uint32, uint32, error) {
+	offset := uint32(0)
+	for collIndex, collHdr := range evt.Header.PayloadCollections {
+		if collHdr.Name == name {
+			if uint64(offset)+uint64(collHdr.PayloadSize) > uint64(len(evt.payload)) {
+				return 0, 0, 0, ErrCorruptCollection
+			}
+			return collIndex, offset, collHdr.PayloadSize, nil
+		}
+		offset += collHdr.PayloadSize
+	}
+	return 0, 0, 0, ErrNoSuchCollection
+}
+
+// Decodes a serialized collection of the given type
+func (evt *Event) unmarshalCollection(collType string, buf []byte) (Collection, error) {
+	var coll Collection
+	typeName := "proio.model." + collType
+	if ptrType := proto.MessageType(typeName); ptrType != nil {
+		msgType := ptrType.Elem()
+		coll = reflect.New(msgType).Interface().(Collection)
+	} else if dynType := evt.descriptors.getType(typeName); dynType != nil {
+		coll = newDynamicMessage(dynType)
+	} else {
+		return nil, ErrUnknownType
+	}
+	if err := coll.Unmarshal(buf); err != nil {
+		return nil, ErrCorruptCollection
+	}
+	return coll, nil
 }
+
+// Returns a collection without modifying the event.  Cached collections are
+// returned as they are, while collections in the payload are decoded afresh
+// on every call, and changes to them are not written out.
+func (evt *Event) peek(name string) (Collection, error) {
+	if coll := evt.collCache[name]; coll != nil {
+		return coll, nil
+	}
+	if coll := evt.viewCache[name]; coll != nil {
+		return coll, nil
+	}
+	collIndex, offset, size, err := evt.locateInPayload(name)
+	if err != nil {
+		return nil, err
+	}
+	collType := evt.Header.PayloadCollections[collIndex].Type
+	return evt.unmarshalCollection(collType, evt.payload[offset:offset+size])
+}
+
+// Serializes cached collections, and lays out the payload in the order of
+// GetNames()
 func (evt *Event) flushCollCache() error {
-	for _, name := range evt.namesCached {
-		coll := evt.collCache[name]
-		if err := evt.collToPayload(coll, name); err != nil {
-			return err
+	if evt.Header == nil {
+		evt.Header = &model.EventHeader{}
+	}
+	order := evt.names()
+
+	inOrder := len(evt.collCache) == 0
+	for i, collHdr := range evt.Header.PayloadCollections {
+		if !inOrder {
+			break
+		}
+		inOrder = order[i] == collHdr.Name
+	}
+	if inOrder {
+		// The header now holds the order
+		evt.order = nil
+		return nil
+	}
+
+	payloadColls := make(map[string]*model.EventHeader_CollectionHeader)
+	payloadBufs := make(map[string][]byte)
+	offset := uint32(0)
+	for _, collHdr := range evt.Header.PayloadCollections {
+		if uint64(offset)+uint64(collHdr.PayloadSize) > uint64(len(evt.payload)) {
+			return ErrCorruptCollection
+		}
+		payloadColls[collHdr.Name] = collHdr
+		payloadBufs[collHdr.Name] = evt.payload[offset : offset+collHdr.PayloadSize]
+		offset += collHdr.PayloadSize
+	}
+
+	collHdrs := make([]*model.EventHeader_CollectionHeader, 0, len(order))
+	payload := make([]byte, 0, len(evt.payload))
+	for _, name := range order {
+		collHdr := payloadColls[name]
+		collBuf := payloadBufs[name]
+		if coll := evt.collCache[name]; coll != nil {
+			var err error
+			if collHdr, collBuf, err = collToPayload(coll, name); err != nil {
+				return err
+			}
 		}
+		collHdrs = append(collHdrs, collHdr)
+		payload = append(payload, collBuf...)
+	}
+
+	evt.Header.PayloadCollections = collHdrs
+	evt.payload = payload
+	for name := range evt.collCache {
 		delete(evt.collCache, name)
 	}
-	evt.namesCached = nil
+	evt.order = nil
+	evt.refs = nil
 	return nil
 }
 
-func (evt *Event) collToPayload(coll Collection, name string) error {
+func collToPayload(coll Collection, name string) (*model.EventHeader_CollectionHeader, []byte, error) {
 	collHdr := &model.EventHeader_CollectionHeader{}
 	collHdr.Name = name
 	collHdr.Id = coll.GetId()
@@ -283,17 +751,28 @@ func (evt *Event) collToPayload(coll Collection, name string) error {
 
 	collBuf, err := coll.Marshal()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	collHdr.PayloadSize = uint32(len(collBuf))
 
-	if evt.Header == nil {
-		evt.Header = &model.EventHeader{}
-	}
-	evt.Header.PayloadCollections = append(evt.Header.PayloadCollections, collHdr)
-	evt.payload = append(evt.payload, collBuf...)
+	return collHdr, collBuf, nil
+}
 
-	return nil
+// Release drops the serialized collections of the event, and recycles the
+// buffer that held them for reading later events.  This reduces allocations
+// when reading many events, e.g. by calling Release() after pushing an event
+// to a Writer.  Collections that have been retrieved with Get() or added with
+// Add() are kept, but the event must not be used otherwise after calling
+// Release().
+func (evt *Event) Release() {
+	if evt.payload != nil && !evt.sharedPayload {
+		putFrameBuffer(evt.payload)
+	}
+	evt.payload = nil
+	evt.sharedPayload = false
+	evt.Header.PayloadCollections = nil
+	evt.viewCache = nil
+	evt.refs = nil
 }
 
 func (evt *Event) getPayload() []byte {
@@ -0,0 +1,77 @@
+//go:build go1.18
+
+package proio
+
+import (
+	"errors"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+var ErrWrongType = errors.New("message is not of the requested type")
+
+// GetAs gets a collection from the event as with (*Event) GetE(), and asserts
+// its type.  In addition to the errors returned by GetE(), ErrWrongType is
+// returned if the collection is of another type.  For example:
+//
+//	MCParticles, err := proio.GetAs[*lcio.MCParticleCollection](event, "MCParticles")
+func GetAs[T Collection](evt *Event, name string) (T, error) {
+	var zero T
+	coll, err := evt.GetE(name)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := coll.(T)
+	if !ok {
+		return zero, ErrWrongType
+	}
+	return typed, nil
+}
+
+// DerefAs dereferences a message from the event as with
+// (*Event) DereferenceE(), and asserts its type.  In addition to the errors
+// returned by DereferenceE(), ErrWrongType is returned if the message is of
+// another type.
+func DerefAs[T Message](evt *Event, ref *model.Reference) (T, error) {
+	var zero T
+	msg, err := evt.DereferenceE(ref)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := msg.(T)
+	if !ok {
+		return zero, ErrWrongType
+	}
+	return typed, nil
+}
+
+// CollectionsOfType returns all collections of the event that have the given
+// type, keyed by name.  Serialized collections of other types are not
+// decoded.  If a collection of the type cannot be decoded, the error from
+// (*Event) GetE() is returned along with the collections that could be.
+func CollectionsOfType[T Collection](evt *Event) (map[string]T, error) {
+	var zero T
+	typeName := ""
+	if _, ok := Collection(zero).(*DynamicMessage); !ok && Collection(zero) != nil {
+		typeName = GetType(zero)
+	}
+
+	var err error
+	colls := make(map[string]T)
+	for _, name := range evt.GetNames() {
+		if typeName != "" && evt.collCache[name] == nil && evt.viewCache[name] == nil && evt.payloadType(name) != typeName {
+			continue
+		}
+		coll, getErr := evt.GetE(name)
+		if getErr != nil {
+			if typeName != "" {
+				err = getErr
+			}
+			continue
+		}
+		if typed, ok := coll.(T); ok {
+			colls[name] = typed
+		}
+	}
+	return colls, err
+}
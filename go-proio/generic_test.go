@@ -0,0 +1,61 @@
+//go:build go1.18
+
+package proio
+
+import (
+	"bytes"
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func TestGenericAccessors(t *testing.T) {
+	event, _ := newCompactTestEvent()
+	event.Add(&prolcio.SimTrackerHitCollection{}, "TrackerHits")
+	event.Add(&prolcio.MCParticleCollection{}, "MoreMCParticles")
+
+	MCParticles, err := GetAs[*prolcio.MCParticleCollection](event, "MCParticles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAs[*prolcio.MCParticleCollection](event, "Missing"); err != ErrNoSuchCollection {
+		t.Errorf("Getting a missing collection returned %v", err)
+	}
+	if _, err := GetAs[*prolcio.MCParticleCollection](event, "TrackerHits"); err != ErrWrongType {
+		t.Errorf("Getting a collection of the wrong type returned %v", err)
+	}
+
+	child := MCParticles.Entries[2]
+	parent, err := DerefAs[*prolcio.MCParticle](event, child.Parents[1])
+	if err != nil || parent != MCParticles.Entries[0] {
+		t.Errorf("Dereferenced %v, %v", parent, err)
+	}
+	if _, err := DerefAs[*prolcio.MCParticle](event, child.Parents[0]); err != ErrDanglingRef {
+		t.Errorf("Dereferencing a dangling reference returned %v", err)
+	}
+	if _, err := DerefAs[*prolcio.SimTrackerHit](event, child.Parents[1]); err != ErrWrongType {
+		t.Errorf("Dereferencing to the wrong type returned %v", err)
+	}
+
+	colls, err := CollectionsOfType[*prolcio.MCParticleCollection](event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(colls) != 2 || colls["MCParticles"] != MCParticles || colls["MoreMCParticles"] == nil {
+		t.Errorf("Found collections %v", colls)
+	}
+
+	event = NewEvent()
+	event.Add(&prolcio.SimTrackerHitCollection{}, "TrackerHits")
+	event.Add(&prolcio.MCParticleCollection{}, "MCParticles")
+	buffer := &bytes.Buffer{}
+	NewWriter(buffer).Push(event)
+	event, _ = NewReader(buffer).Get()
+	colls, err = CollectionsOfType[*prolcio.MCParticleCollection](event)
+	if err != nil || len(colls) != 1 || colls["MCParticles"] == nil {
+		t.Errorf("Found collections %v, %v", colls, err)
+	}
+	if len(event.Header.PayloadCollections) != 1 {
+		t.Error("Collection of another type was decoded")
+	}
+}
@@ -0,0 +1,282 @@
+package proio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Gzip streams may be split into independent members (as in BGZF), each
+// starting at a record boundary.  Positions within such streams are given as
+// virtual offsets: the offset of the member in the compressed stream, shifted
+// left by gzipOffsetBits, plus the uncompressed offset within the member.
+const gzipOffsetBits = 16
+
+// The largest value of Writer.GzipBlockSize.  Records are only ever started
+// at uncompressed offsets within a member that fit in a virtual offset.
+const MaxGzipBlockSize = 1 << gzipOffsetBits
+
+var ErrGzipNotBlocked = errors.New("gzip stream is not split into blocks at record boundaries")
+
+// The members of gzip streams written in blocks carry this subfield in the
+// extra field of their headers, so that readers know that records start
+// within the first MaxGzipBlockSize bytes of a member
+var gzipBlockExtra = []byte{'P', 'B', 0, 0}
+
+// blockGzipWriter is a gzip.Writer that can end the current member and begin
+// a new one
+type blockGzipWriter struct {
+	*gzip.Writer
+	target  io.Writer
+	blocked bool
+}
+
+func newBlockGzipWriter(byteWriter io.Writer) *blockGzipWriter {
+	return &blockGzipWriter{
+		Writer: gzip.NewWriter(byteWriter),
+		target: byteWriter,
+	}
+}
+
+func (wrt *blockGzipWriter) newMember() error {
+	if err := wrt.Writer.Close(); err != nil {
+		return err
+	}
+	wrt.Writer.Reset(wrt.target)
+	if wrt.blocked {
+		wrt.Writer.Header.Extra = gzipBlockExtra
+	}
+	return nil
+}
+
+// Marks the current and following members as blocks.  The header of the
+// current member must not have been written yet.
+func (wrt *blockGzipWriter) markBlocked() {
+	wrt.blocked = true
+	wrt.Writer.Header.Extra = gzipBlockExtra
+}
+
+// countingReader keeps track of the number of compressed bytes consumed by
+// the gzip.Reader.  Since it implements io.ByteReader, the gzip.Reader does
+// not read ahead of the end of a member.
+type countingReader struct {
+	*bufio.Reader
+	n int64
+}
+
+func (rdr *countingReader) Read(p []byte) (int, error) {
+	n, err := rdr.Reader.Read(p)
+	rdr.n += int64(n)
+	return n, err
+}
+
+func (rdr *countingReader) ReadByte() (byte, error) {
+	b, err := rdr.Reader.ReadByte()
+	if err == nil {
+		rdr.n++
+	}
+	return b, err
+}
+
+// blockGzipReader decompresses a seekable gzip stream one member at a time,
+// and implements io.Seeker in terms of virtual offsets.  Any gzip stream can
+// be read, but only positions that lie within the first MaxGzipBlockSize
+// uncompressed bytes of a member can be represented, so it is only used for
+// streams written in blocks (see isBlocked()).
+type blockGzipReader struct {
+	file         io.ReadSeeker
+	compressed   *countingReader
+	gzReader     *gzip.Reader
+	inMember     bool
+	memberStart  int64
+	memberOffset int64
+	byteBuf      [1]byte
+	// A byte read ahead by tell(), and whether it ended its member
+	peeked    bool
+	peekedEOF bool
+	peekBuf   [1]byte
+}
+
+func newBlockGzipReader(file io.ReadSeeker) (*blockGzipReader, error) {
+	start, err := file.Seek(0, 1 /*io.SeekCurrent*/)
+	if err != nil {
+		return nil, err
+	}
+	rdr := &blockGzipReader{
+		file:       file,
+		compressed: &countingReader{Reader: bufio.NewReader(file), n: start},
+	}
+	// Fail early on streams that are not gzip compressed
+	if err := rdr.startMember(); err != nil {
+		return nil, err
+	}
+	return rdr, nil
+}
+
+func (rdr *blockGzipReader) startMember() error {
+	if _, err := rdr.compressed.Peek(1); err != nil {
+		return err
+	}
+
+	rdr.memberStart = rdr.compressed.n
+	rdr.memberOffset = 0
+	var err error
+	if rdr.gzReader == nil {
+		rdr.gzReader, err = gzip.NewReader(rdr.compressed)
+	} else {
+		err = rdr.gzReader.Reset(rdr.compressed)
+	}
+	if err != nil {
+		return err
+	}
+	rdr.gzReader.Multistream(false)
+	rdr.inMember = true
+	return nil
+}
+
+func (rdr *blockGzipReader) Read(p []byte) (int, error) {
+	if rdr.peeked && len(p) > 0 {
+		p[0] = rdr.peekBuf[0]
+		rdr.peeked = false
+		rdr.memberOffset++
+		if rdr.peekedEOF {
+			rdr.inMember = false
+		}
+		return 1, nil
+	}
+
+	for {
+		if !rdr.inMember {
+			if err := rdr.startMember(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := rdr.gzReader.Read(p)
+		rdr.memberOffset += int64(n)
+		if err == io.EOF {
+			rdr.inMember = false
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (rdr *blockGzipReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(rdr, rdr.byteBuf[:]); err != nil {
+		return 0, err
+	}
+	return rdr.byteBuf[0], nil
+}
+
+func (rdr *blockGzipReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 1 /*io.SeekCurrent*/ :
+		current, err := rdr.tell()
+		if err != nil || offset == 0 {
+			return current, err
+		}
+		offset += current
+	case 2 /*io.SeekEnd*/ :
+		end, err := rdr.file.Seek(0, 2 /*io.SeekEnd*/)
+		if err != nil {
+			return 0, err
+		}
+		offset += end << gzipOffsetBits
+	}
+
+	compressedOffset := offset >> gzipOffsetBits
+	memberOffset := offset & (MaxGzipBlockSize - 1)
+	if _, err := rdr.file.Seek(compressedOffset, 0 /*io.SeekStart*/); err != nil {
+		return 0, err
+	}
+	rdr.compressed.Reset(rdr.file)
+	rdr.compressed.n = compressedOffset
+	rdr.inMember = false
+	rdr.peeked = false
+
+	if memberOffset > 0 {
+		if err := rdr.skipBytes(memberOffset); err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
+
+func (rdr *blockGzipReader) tell() (int64, error) {
+	if rdr.inMember && !rdr.peeked && rdr.memberOffset >= MaxGzipBlockSize {
+		// Records larger than a block end where their member ends, which
+		// is also where the next member begins
+		n, err := rdr.gzReader.Read(rdr.peekBuf[:])
+		switch {
+		case n == 1:
+			rdr.peeked = true
+			rdr.peekedEOF = err == io.EOF
+		case err == io.EOF:
+			rdr.inMember = false
+		case err != nil:
+			return 0, err
+		}
+	}
+	if !rdr.inMember {
+		return rdr.compressed.n << gzipOffsetBits, nil
+	}
+	if rdr.memberOffset >= MaxGzipBlockSize {
+		return 0, ErrGzipNotBlocked
+	}
+	return rdr.memberStart<<gzipOffsetBits | rdr.memberOffset, nil
+}
+
+// Advances the uncompressed stream by decompressing and discarding
+func (rdr *blockGzipReader) skipBytes(nBytes int64) error {
+	n, err := io.CopyN(ioutil.Discard, rdr, nBytes)
+	if n == nBytes {
+		return nil
+	}
+	return err
+}
+
+func (rdr *blockGzipReader) Close() error {
+	if rdr.gzReader == nil {
+		return nil
+	}
+	return rdr.gzReader.Close()
+}
+
+// Reports whether the current member is marked as a block by the Writer
+func (rdr *blockGzipReader) isBlocked() bool {
+	return bytes.Equal(rdr.gzReader.Header.Extra, gzipBlockExtra)
+}
+
+// Returns a decompressor for a gzip stream.  Seekable streams written in
+// blocks (see Writer.GzipBlockSize) are read one member at a time so that
+// they remain seekable.  Other streams are not seekable.
+func newGzipReader(byteReader io.Reader) (io.ReadCloser, error) {
+	if file, ok := byteReader.(io.ReadSeeker); ok {
+		if start, err := file.Seek(0, 1 /*io.SeekCurrent*/); err == nil {
+			rdr, err := newBlockGzipReader(file)
+			if err != nil {
+				return nil, err
+			}
+			if rdr.isBlocked() {
+				return rdr, nil
+			}
+			if _, err := file.Seek(start, 0 /*io.SeekStart*/); err != nil {
+				return nil, err
+			}
+			byteReader = &readerOnly{file}
+		}
+	}
+	return gzip.NewReader(byteReader)
+}
+
+// readerOnly hides any methods of a stream other than Read()
+type readerOnly struct {
+	io.Reader
+}
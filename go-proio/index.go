@@ -0,0 +1,433 @@
+package proio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+// IndexEntry describes the location of a single event within a seekable
+// stream.  Offset points to the magic number at the start of the event.
+type IndexEntry struct {
+	Offset      int64
+	HeaderSize  uint32
+	PayloadSize uint32
+	RunNumber   uint64
+	EventNumber uint64
+}
+
+// Index provides random access to the events of a seekable stream.  The
+// ordinal of an event is its position in Entries.
+type Index struct {
+	Entries []IndexEntry
+
+	// MetadataOffsets points to the magic numbers of the metadata records in
+	// the stream, so that the metadata in effect for an event can be reloaded
+	// when seeking to it.
+	MetadataOffsets []int64
+
+	// StreamSize is the size in bytes of the stream that was indexed.  It is
+	// used to detect stale sidecar index files.
+	StreamSize int64
+
+	byRunEvent []int
+}
+
+var (
+	ErrEventNotFound = errors.New("event not found in index")
+	ErrBadIndex      = errors.New("index is invalid or corrupted")
+)
+
+// Returns the number of events in the index
+func (idx *Index) NEvents() int {
+	return len(idx.Entries)
+}
+
+// Find the ordinal of the event with the given run and event numbers.  The
+// lookup is a binary search over a lazily constructed sorted view of the
+// entries.  If more than one event has the same run and event number, the one
+// appearing first in the stream is returned.
+func (idx *Index) Find(runNumber, eventNumber uint64) (int, error) {
+	if idx.byRunEvent == nil {
+		idx.byRunEvent = make([]int, len(idx.Entries))
+		for i := range idx.byRunEvent {
+			idx.byRunEvent[i] = i
+		}
+		sort.SliceStable(idx.byRunEvent, func(i, j int) bool {
+			return idx.less(idx.byRunEvent[i], idx.byRunEvent[j])
+		})
+	}
+
+	i := sort.Search(len(idx.byRunEvent), func(i int) bool {
+		entry := &idx.Entries[idx.byRunEvent[i]]
+		if entry.RunNumber != runNumber {
+			return entry.RunNumber > runNumber
+		}
+		return entry.EventNumber >= eventNumber
+	})
+	if i < len(idx.byRunEvent) {
+		entry := &idx.Entries[idx.byRunEvent[i]]
+		if entry.RunNumber == runNumber && entry.EventNumber == eventNumber {
+			return idx.byRunEvent[i], nil
+		}
+	}
+
+	return -1, ErrEventNotFound
+}
+
+func (idx *Index) less(i, j int) bool {
+	a, b := &idx.Entries[i], &idx.Entries[j]
+	if a.RunNumber != b.RunNumber {
+		return a.RunNumber < b.RunNumber
+	}
+	return a.EventNumber < b.EventNumber
+}
+
+var indexMagicBytes = [...]byte{
+	byte('P'),
+	byte('I'),
+	byte('D'),
+	byte('X'),
+}
+
+const indexEntrySize = 32
+
+// Serialize the index to a stream.  The format is the index magic number,
+// followed by the indexed stream size and number of entries, followed by
+// fixed-size entries, followed by the number of metadata offsets and the
+// offsets themselves, all little-endian.
+func (idx *Index) Write(byteWriter io.Writer) error {
+	buf := make([]byte, idx.encodedSize())
+	copy(buf, indexMagicBytes[:])
+	binary.LittleEndian.PutUint64(buf[4:], uint64(idx.StreamSize))
+	binary.LittleEndian.PutUint64(buf[12:], uint64(len(idx.Entries)))
+
+	entryBuf := buf[20:]
+	for _, entry := range idx.Entries {
+		binary.LittleEndian.PutUint64(entryBuf, uint64(entry.Offset))
+		binary.LittleEndian.PutUint32(entryBuf[8:], entry.HeaderSize)
+		binary.LittleEndian.PutUint32(entryBuf[12:], entry.PayloadSize)
+		binary.LittleEndian.PutUint64(entryBuf[16:], entry.RunNumber)
+		binary.LittleEndian.PutUint64(entryBuf[24:], entry.EventNumber)
+		entryBuf = entryBuf[indexEntrySize:]
+	}
+
+	binary.LittleEndian.PutUint64(entryBuf, uint64(len(idx.MetadataOffsets)))
+	for i, offset := range idx.MetadataOffsets {
+		binary.LittleEndian.PutUint64(entryBuf[8+8*i:], uint64(offset))
+	}
+
+	_, err := byteWriter.Write(buf)
+	return err
+}
+
+// Returns the number of bytes written by (*Index) Write()
+func (idx *Index) encodedSize() int {
+	return 20 + indexEntrySize*len(idx.Entries) + 8 + 8*len(idx.MetadataOffsets)
+}
+
+// Deserialize an index previously serialized with (*Index) Write()
+func ReadIndex(byteReader io.Reader) (*Index, error) {
+	prefix := make([]byte, 20)
+	if err := readBytes(byteReader, prefix); err != nil {
+		return nil, ErrBadIndex
+	}
+	for i, magicByte := range indexMagicBytes {
+		if prefix[i] != magicByte {
+			return nil, ErrBadIndex
+		}
+	}
+
+	idx := &Index{}
+	idx.StreamSize = int64(binary.LittleEndian.Uint64(prefix[4:]))
+	nEntries := binary.LittleEndian.Uint64(prefix[12:])
+
+	entryBuf := make([]byte, indexEntrySize)
+	for i := uint64(0); i < nEntries; i++ {
+		if err := readBytes(byteReader, entryBuf); err != nil {
+			return nil, ErrBadIndex
+		}
+		idx.Entries = append(idx.Entries, IndexEntry{
+			Offset:      int64(binary.LittleEndian.Uint64(entryBuf)),
+			HeaderSize:  binary.LittleEndian.Uint32(entryBuf[8:]),
+			PayloadSize: binary.LittleEndian.Uint32(entryBuf[12:]),
+			RunNumber:   binary.LittleEndian.Uint64(entryBuf[16:]),
+			EventNumber: binary.LittleEndian.Uint64(entryBuf[24:]),
+		})
+	}
+
+	// Indices written before metadata offsets were recorded end here
+	offsetBuf := entryBuf[:8]
+	if n, err := io.ReadFull(byteReader, offsetBuf); n == 0 && err == io.EOF {
+		return idx, nil
+	} else if err != nil {
+		return nil, ErrBadIndex
+	}
+	nOffsets := binary.LittleEndian.Uint64(offsetBuf)
+	for i := uint64(0); i < nOffsets; i++ {
+		if err := readBytes(byteReader, offsetBuf); err != nil {
+			return nil, ErrBadIndex
+		}
+		idx.MetadataOffsets = append(idx.MetadataOffsets, int64(binary.LittleEndian.Uint64(offsetBuf)))
+	}
+
+	return idx, nil
+}
+
+// Returns the name of the sidecar index file that caches the index for the
+// given proio file
+func IndexFilename(filename string) string {
+	return filename + ".idx"
+}
+
+// Saves the index to a sidecar file.  See IndexFilename().
+func (idx *Index) WriteFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := idx.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Loads an index from a sidecar file.  See IndexFilename().
+func ReadIndexFile(filename string) (*Index, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadIndex(file)
+}
+
+// Returns the index of the stream.  If the Reader does not have one yet, it
+// is loaded from the trailer of the stream (see Writer.Trailer) if there is
+// one, and otherwise built with (*Reader) BuildIndex().
+func (rdr *Reader) Index() (*Index, error) {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	return rdr.loadIndex()
+}
+
+// Returns the index of the stream if it is available without scanning the
+// stream, i.e. if the Reader already has one (e.g. from a sidecar file found
+// by Open()) or the stream ends with a trailer, and nil otherwise.  Building
+// an index costs a scan of the whole stream, so for a one-off access to an
+// event, Skip() is cheaper unless an index is available.
+func (rdr *Reader) AvailableIndex() *Index {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	if rdr.index == nil {
+		if _, idx, err := rdr.readTrailer(); err == nil {
+			rdr.index = idx
+		}
+	}
+	return rdr.index
+}
+
+// Sets the index used for random access.  This is useful for reusing an index
+// loaded with ReadIndex() or ReadIndexFile().  Open() does this automatically
+// when a matching sidecar index file is found.
+func (rdr *Reader) SetIndex(idx *Index) {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	rdr.index = idx
+}
+
+// Scans the entire stream, reading only headers and seeking past payloads, in
+// order to construct an Index.  The stream must implement io.Seeker.  Once the
+// index is built, the stream is reset back to the beginning, and the index is
+// used by subsequent calls to SeekToEvent() and SeekToRunEvent().  A
+// truncated final record is left out of the index, but any other error ends
+// the scan and is returned, without an index.  (Earlier versions ended the
+// scan quietly at any error, returning the partial index with a nil error.)
+func (rdr *Reader) BuildIndex() (*Index, error) {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	return rdr.buildIndex()
+}
+
+func (rdr *Reader) buildIndex() (*Index, error) {
+	seeker, ok := rdr.byteReader.(io.Seeker)
+	if !ok {
+		return nil, ErrNotSeekable
+	}
+	streamSize, err := seeker.Seek(0, 2 /*io.SeekEnd*/)
+	if err != nil {
+		return nil, err
+	}
+	if err := rdr.seekToStart(); err != nil {
+		return nil, err
+	}
+
+	idx := &Index{StreamSize: streamSize}
+	for {
+		_, recordType, err := rdr.syncToMagic()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		offset, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+		if err != nil {
+			return nil, err
+		}
+		offset -= int64(len(magicBytes))
+
+		// A truncated final record is left out of the index, as it cannot
+		// be read anyway, and so are records that fail their checksums.
+		// Trailers are skipped.
+		if recordType&^checksumFlag == metadataRecord {
+			err := rdr.readMetadata(recordType)
+			if isTruncation(err) {
+				break
+			} else if err != nil && err != ErrChecksum {
+				return nil, err
+			}
+			if err == nil {
+				idx.MetadataOffsets = append(idx.MetadataOffsets, offset)
+			}
+			continue
+		} else if recordType&^checksumFlag == trailerRecord {
+			err := rdr.skipRecord(recordType)
+			if isTruncation(err) {
+				break
+			} else if err != nil && err != ErrChecksum {
+				return nil, err
+			}
+			continue
+		}
+
+		headerSize, payloadSize, _, err := rdr.readFrameSizes(recordType)
+		if err == ErrChecksum {
+			continue
+		} else if isTruncation(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		headerBuf := make([]byte, headerSize)
+		if err = readBytes(rdr.byteReader, headerBuf); isTruncation(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		header := &model.EventHeader{}
+		if err = header.Unmarshal(headerBuf); err != nil {
+			return nil, err
+		}
+		if err = seekBytes(seeker, int64(payloadSize)); isTruncation(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// Seeking past the end of a file succeeds
+		end, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+		if err != nil {
+			return nil, err
+		}
+		if end > streamSize {
+			break
+		}
+
+		idx.Entries = append(idx.Entries, IndexEntry{
+			Offset:      offset,
+			HeaderSize:  headerSize,
+			PayloadSize: payloadSize,
+			RunNumber:   header.RunNumber,
+			EventNumber: header.EventNumber,
+		})
+	}
+
+	if err := rdr.seekToStart(); err != nil {
+		return nil, err
+	}
+	rdr.index = idx
+
+	return idx, nil
+}
+
+// Reports whether an error means that the stream ended within a record
+func isTruncation(err error) bool {
+	return err == ErrTruncated || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Position the stream at the start of the nth event (counting from zero) so
+// that the next call to Get() or GetHeader() returns it.  The metadata in
+// effect for the event are reloaded.  If the Reader does not yet have an
+// index, one is loaded or built as by Index().
+func (rdr *Reader) SeekToEvent(n int) error {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	return rdr.seekToEvent(n)
+}
+
+// Position the stream at the start of the event with the given run and event
+// numbers.  If the Reader does not yet have an index, one is loaded or built
+// as by Index().
+func (rdr *Reader) SeekToRunEvent(runNumber, eventNumber uint64) error {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	if _, err := rdr.loadIndex(); err != nil {
+		return err
+	}
+
+	n, err := rdr.index.Find(runNumber, eventNumber)
+	if err != nil {
+		return err
+	}
+	return rdr.seekToEvent(n)
+}
+
+func (rdr *Reader) seekToEvent(n int) error {
+	seeker, ok := rdr.byteReader.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	if _, err := rdr.loadIndex(); err != nil {
+		return err
+	}
+	if n < 0 || n >= len(rdr.index.Entries) {
+		return ErrEventNotFound
+	}
+
+	offset := rdr.index.Entries[n].Offset
+	rdr.metadata = nil
+	for _, metaOffset := range rdr.index.MetadataOffsets {
+		if metaOffset > offset {
+			break
+		}
+		if _, err := seeker.Seek(metaOffset, 0 /*io.SeekStart*/); err != nil {
+			return err
+		}
+		nRead, recordType, err := rdr.syncToMagic()
+		if err != nil {
+			return err
+		}
+		if nRead != len(magicBytes) || recordType&^checksumFlag != metadataRecord {
+			return ErrBadIndex
+		}
+		if err := rdr.readMetadata(recordType); err != nil {
+			return err
+		}
+	}
+
+	_, err := seeker.Seek(offset, 0 /*io.SeekStart*/)
+	return err
+}
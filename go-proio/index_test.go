@@ -0,0 +1,176 @@
+package proio
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func writeIndexTestFile(t *testing.T, nEvents int) string {
+	dir, err := ioutil.TempDir("", "proio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "index.proio")
+
+	writer, err := Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestEvents(t, writer, nEvents, func(i int, event *Event) {
+		event.Header.RunNumber = uint64(i / 4)
+		event.Header.EventNumber = uint64(i % 4)
+
+		MCParticles := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+		for j := 1; j <= i; j++ {
+			MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: int32(j)})
+		}
+	})
+
+	return filename
+}
+
+func TestSeekToEvent(t *testing.T) {
+	filename := writeIndexTestFile(t, 10)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	reader, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	idx, err := reader.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 10 {
+		t.Errorf("Index has %v events instead of 10", idx.NEvents())
+	}
+
+	for _, n := range []int{7, 2, 9, 0} {
+		if err := reader.SeekToEvent(n); err != nil {
+			t.Fatal(err)
+		}
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nEntries := event.Get("MCParticles").GetNEntries(); nEntries != uint32(n+1) {
+			t.Errorf("Event %v has %v entries instead of %v", n, nEntries, n+1)
+		}
+	}
+
+	if err := reader.SeekToRunEvent(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	header, err := reader.GetHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.RunNumber != 1 || header.EventNumber != 2 {
+		t.Errorf("Seeked to run %v event %v instead of run 1 event 2", header.RunNumber, header.EventNumber)
+	}
+
+	if err := reader.SeekToEvent(10); err != ErrEventNotFound {
+		t.Errorf("Seeking past the last event returned %v", err)
+	}
+	if err := reader.SeekToRunEvent(5, 0); err != ErrEventNotFound {
+		t.Errorf("Seeking to a missing run returned %v", err)
+	}
+}
+
+func TestIndexSidecar(t *testing.T) {
+	filename := writeIndexTestFile(t, 5)
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	reader, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.AvailableIndex() != nil {
+		t.Error("Index available without sidecar")
+	}
+	idx, err := reader.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+
+	buffer := &bytes.Buffer{}
+	if err := idx.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	idxIn, err := ReadIndex(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idxIn.StreamSize != idx.StreamSize || len(idxIn.Entries) != len(idx.Entries) {
+		t.Fatal("Index corrupted")
+	}
+	for i := range idx.Entries {
+		if idxIn.Entries[i] != idx.Entries[i] {
+			t.Errorf("Index entry %v corrupted", i)
+		}
+	}
+
+	if err := idx.WriteFile(IndexFilename(filename)); err != nil {
+		t.Fatal(err)
+	}
+	reader, err = Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.AvailableIndex() == nil {
+		t.Error("Sidecar index was not loaded")
+	}
+}
+
+var errTestSeek = errors.New("seek failed")
+
+// failingSeeker fails to report its position once nTells positions have been
+// reported
+type failingSeeker struct {
+	*bytes.Reader
+	nTells int
+}
+
+func (seeker *failingSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == 1 /*io.SeekCurrent*/ {
+		if seeker.nTells == 0 {
+			return 0, errTestSeek
+		}
+		seeker.nTells--
+	}
+	return seeker.Reader.Seek(offset, whence)
+}
+
+func TestBuildIndexErrors(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), 3, nil)
+	data := buffer.Bytes()
+
+	// A truncated final record is left out quietly
+	idx, err := NewReader(bytes.NewReader(data[:len(data)-3])).BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 2 {
+		t.Errorf("Index of truncated stream has %v events instead of 2", idx.NEvents())
+	}
+
+	// Other errors are returned rather than truncating the index
+	reader := NewReader(&failingSeeker{Reader: bytes.NewReader(data), nTells: 3})
+	if _, err := reader.BuildIndex(); err != errTestSeek {
+		t.Errorf("BuildIndex() returned %v", err)
+	}
+	if reader.index != nil {
+		t.Error("Failed BuildIndex() set an index")
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.23
+
+package proio
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the remaining events in the stream, for use
+// with range-over-func:
+//
+//	for event, err := range reader.All(ctx) {
+//		if err != nil && err != proio.ErrResync {
+//			...
+//		}
+//		...
+//	}
+//
+// Events are yielded with a nil error, or with ErrResync if the stream had to
+// be resynchronized to find them.  Any other error, including the context
+// error if the context is canceled, is yielded with a nil event and ends the
+// iteration.  The end of the stream is not reported as an error.
+func (rdr *Reader) All(ctx context.Context) iter.Seq2[*Event, error] {
+	return func(yield func(*Event, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			event, err := rdr.Get()
+			if event == nil {
+				if err != io.EOF {
+					yield(nil, err)
+				}
+				return
+			}
+			if !yield(event, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build go1.23
+
+package proio
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), 10, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := NewReader(buffer)
+	nEvents := 0
+	var lastErr error
+	for event, err := range reader.All(ctx) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		if event.Header.EventNumber != uint64(nEvents) {
+			t.Errorf("Event %v arrived in position %v", event.Header.EventNumber, nEvents)
+		}
+		nEvents++
+		if nEvents == 4 {
+			cancel()
+		}
+	}
+	if nEvents != 4 || lastErr != context.Canceled {
+		t.Errorf("Iteration stopped after %v events with %v", nEvents, lastErr)
+	}
+
+	nEvents = 0
+	for _, err := range reader.All(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		nEvents++
+	}
+	if nEvents != 6 {
+		t.Errorf("Resumed iteration read %v events instead of 6", nEvents)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 
 	"github.com/decibelcooper/proio/go-proio"
 	"github.com/decibelcooper/proio/go-proio/model"
@@ -17,6 +18,7 @@ import (
 var (
 	outFile = flag.String("o", "", "file to save output to")
 	doGzip  = flag.Bool("g", false, "compress the stdout output with gzip")
+	embed   = flag.Bool("d", false, "embed data model descriptors so that the output is self-describing")
 )
 
 func printUsage() {
@@ -56,9 +58,18 @@ func main() {
 			log.Fatal(err)
 		}
 	}
-	defer proioWriter.Close()
+	proioWriter.EmbedDescriptors = *embed
 
+	var runHeader *lcio.RunHeader
 	for lcioReader.Next() {
+		// Run headers apply to the events that follow them, as metadata do
+		if lcioRunHeader := lcioReader.RunHeader(); runHeader == nil || !reflect.DeepEqual(*runHeader, lcioRunHeader) {
+			runHeader = &lcioRunHeader
+			if err := pushRunHeader(proioWriter, runHeader); err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		lcioEvent := lcioReader.Event()
 		proioEvent := proio.NewEvent()
 
@@ -111,13 +122,42 @@ func main() {
 			}
 		}
 
-		proioWriter.Push(proioEvent)
+		if err := proioWriter.Push(proioEvent); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	err = lcioReader.Err()
 	if err != nil && err != io.EOF {
 		log.Fatal(err)
 	}
+
+	if err := proioWriter.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func pushRunHeader(writer *proio.Writer, runHeader *lcio.RunHeader) error {
+	params, err := convertParams(runHeader.Params).Marshal()
+	if err != nil {
+		return err
+	}
+
+	metadata := []struct {
+		key   string
+		value []byte
+	}{
+		{"lcio.RunHeader.Detector", []byte(runHeader.Detector)},
+		{"lcio.RunHeader.Description", []byte(runHeader.Descr)},
+		{"lcio.RunHeader.SubDetectors", []byte(strings.Join(runHeader.SubDetectors, "\n"))},
+		{"lcio.RunHeader.Params", params},
+	}
+	for _, entry := range metadata {
+		if err := writer.PushMetadata(entry.key, entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func convertIntParams(intParams map[string][]int32) map[string]*model.IntParams {
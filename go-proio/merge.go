@@ -0,0 +1,153 @@
+package proio
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	"github.com/golang/protobuf/proto"
+)
+
+// Returns a deep copy of the event.  Collections that have been deserialized
+// are copied as well, so that the copy may be modified without affecting the
+// original.
+func (evt *Event) Clone() *Event {
+	clone := &Event{
+		Header:      proto.Clone(evt.Header).(*model.EventHeader),
+		Logger:      evt.Logger,
+		ReadOnly:    evt.ReadOnly,
+		Metadata:    evt.Metadata,
+		payload:     append([]byte(nil), evt.payload...),
+		collCache:   make(map[string]Collection),
+		order:       append([]string(nil), evt.order...),
+		descriptors: evt.descriptors,
+	}
+	for name, coll := range evt.collCache {
+		clone.collCache[name] = cloneCollection(coll)
+	}
+	return clone
+}
+
+func cloneCollection(coll Collection) Collection {
+	if dynColl, ok := coll.(*DynamicMessage); ok {
+		return dynColl.clone()
+	}
+	return proto.Clone(coll).(Collection)
+}
+
+// Merge copies all collections of another event into this one, e.g. to overlay
+// background onto a signal event.  The other event is left unchanged.  The
+// prefix is prepended to the name of each copied collection, and names that
+// still collide with existing collections are made unique by appending a
+// number.  Every collection and entry ID of the copies is replaced by a new
+// unique ID of this event, and all References held by the copied entries are
+// remapped accordingly, so that they remain valid.  References of the other
+// event that were dangling remain dangling.  New IDs are allocated above the
+// largest ID already in this event, and Header.NUniqueIDs is raised to the
+// last one.  If any collection of the other event cannot be decoded, the error
+// from (*Event) GetE() is returned and this event is left unchanged.
+func (evt *Event) Merge(other *Event, prefix string) error {
+	other = other.Clone()
+
+	names := other.GetNames()
+	sort.Strings(names)
+
+	colls := make([]Collection, len(names))
+	for i, name := range names {
+		var err error
+		if colls[i], err = other.GetE(name); err != nil {
+			return err
+		}
+	}
+
+	// IDs are allocated above any ID already in use, since events written
+	// by other tools may not have counted them in Header.NUniqueIDs
+	lastID := evt.maxUniqueID()
+	ids := make(map[uint32]uint32)
+	remap := func(id uint32) uint32 {
+		if id == 0 {
+			return 0
+		}
+		newID, ok := ids[id]
+		if !ok {
+			lastID++
+			newID = lastID
+			ids[id] = newID
+		}
+		return newID
+	}
+
+	for _, coll := range colls {
+		coll.SetId(remap(coll.GetId()))
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			if entry, ok := coll.GetEntry(i).(Message); ok {
+				entry.SetId(remap(entry.GetId()))
+			}
+		}
+	}
+	for _, coll := range colls {
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			entry, ok := coll.GetEntry(i).(Message)
+			if !ok {
+				continue
+			}
+			visitReferences(entry, "", func(_ string, key refKey, update func(refKey)) bool {
+				update(refKey{remap(key.collID), remap(key.entryID)})
+				return true
+			})
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, name := range evt.GetNames() {
+		existing[name] = true
+	}
+	newNames := make([]string, len(names))
+	for i, name := range names {
+		newName := prefix + name
+		for n := 1; existing[newName]; n++ {
+			newName = fmt.Sprint(prefix, name, "_", n)
+		}
+		existing[newName] = true
+		newNames[i] = newName
+	}
+
+	// The names and IDs of the copies are unique, so adding them cannot fail
+	for i, coll := range colls {
+		evt.Add(coll, newNames[i])
+	}
+	if lastID > evt.Header.NUniqueIDs {
+		evt.Header.NUniqueIDs = lastID
+	}
+
+	return nil
+}
+
+// Returns the largest ID of any collection or entry in the event, or
+// Header.NUniqueIDs if it is larger.  Collections that cannot be decoded only
+// contribute the collection IDs in their headers.
+func (evt *Event) maxUniqueID() uint32 {
+	maxID := evt.Header.NUniqueIDs
+	see := func(id uint32) {
+		if id > maxID {
+			maxID = id
+		}
+	}
+
+	for _, collHdr := range evt.Header.PayloadCollections {
+		see(collHdr.Id)
+	}
+	for _, name := range evt.names() {
+		coll, err := evt.peek(name)
+		if err != nil {
+			continue
+		}
+		see(coll.GetId())
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			if entry, ok := coll.GetEntry(i).(Message); ok {
+				see(entry.GetId())
+			}
+		}
+	}
+	return maxID
+}
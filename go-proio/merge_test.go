@@ -0,0 +1,123 @@
+package proio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func newMergeTestEvent(pdg int32) *Event {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	parent := &prolcio.MCParticle{PDG: pdg}
+	child := &prolcio.MCParticle{PDG: pdg + 1}
+	MCParticles.Entries = append(MCParticles.Entries, parent, child)
+	child.Parents = append(child.Parents, event.Reference(parent))
+	parent.Children = append(parent.Children, event.Reference(child))
+	return event
+}
+
+func TestClone(t *testing.T) {
+	event := newMergeTestEvent(11)
+	clone := event.Clone()
+
+	MCParticles := clone.Get("MCParticles").(*prolcio.MCParticleCollection)
+	MCParticles.Entries[0].PDG = 13
+	if event.Get("MCParticles").(*prolcio.MCParticleCollection).Entries[0].PDG != 11 {
+		t.Error("Modifying the clone modified the original")
+	}
+	if clone.Dereference(MCParticles.Entries[1].Parents[0]) != MCParticles.Entries[0] {
+		t.Error("Reference in clone does not resolve within clone")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	signal := newMergeTestEvent(11)
+
+	// Merge a serialized event to exercise collections in the payload
+	buffer := &bytes.Buffer{}
+	NewWriter(buffer).Push(newMergeTestEvent(2212))
+	background, _ := NewReader(buffer).Get()
+	if err := signal.Merge(background, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := signal.Merge(background, "bkg"); err != nil {
+		t.Fatal(err)
+	}
+	if len(background.Header.PayloadCollections) != 1 {
+		t.Error("Merging modified the other event")
+	}
+
+	for _, name := range []string{"MCParticles", "MCParticles_1", "bkgMCParticles"} {
+		coll, ok := signal.Get(name).(*prolcio.MCParticleCollection)
+		if !ok {
+			t.Fatalf("Collection %v is missing", name)
+		}
+		parent := signal.Dereference(coll.Entries[1].Parents[0])
+		if parent != coll.Entries[0] {
+			t.Errorf("Reference in %v resolves to %v", name, parent)
+		}
+	}
+	if signal.Header.NUniqueIDs != 9 {
+		t.Errorf("Event has %v unique IDs instead of 9", signal.Header.NUniqueIDs)
+	}
+	if err := signal.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeSample(t *testing.T) {
+	filename := "../samples/smallSample.proio"
+	reader, err := Open(filename)
+	if err != nil {
+		t.Skip("Skipping sample merge test: missing input file ", filename)
+	}
+	defer reader.Close()
+	signal, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	background, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files converted from LCIO do not count their IDs in NUniqueIDs
+	nNames := len(signal.GetNames())
+	if err := signal.Merge(background, "bkg"); err != nil {
+		t.Fatal(err)
+	}
+	if len(signal.GetNames()) != 2*nNames {
+		t.Errorf("Merged event has %v collections instead of %v", len(signal.GetNames()), 2*nNames)
+	}
+	if err := signal.Validate(); err != nil {
+		t.Error(err)
+	}
+	MCParticles := signal.Get("bkgMCParticle").(*prolcio.MCParticleCollection)
+	merged := make(map[Message]bool)
+	for _, particle := range MCParticles.Entries {
+		merged[particle] = true
+	}
+	for _, particle := range MCParticles.Entries {
+		for _, ref := range particle.Parents {
+			if !merged[signal.Dereference(ref)] {
+				t.Fatal("Parent reference does not resolve within merged collection")
+			}
+		}
+	}
+
+	// A failed merge leaves the event unchanged
+	nUniqueIDs := signal.Header.NUniqueIDs
+	broken := NewEvent()
+	broken.Header.PayloadCollections = append(broken.Header.PayloadCollections,
+		&model.EventHeader_CollectionHeader{Name: "Broken", Type: "NoSuchType"})
+	if err := signal.Merge(broken, ""); err != ErrUnknownType {
+		t.Errorf("Merging an undecodable event returned %v", err)
+	}
+	if signal.Header.NUniqueIDs != nUniqueIDs || len(signal.GetNames()) != 2*nNames {
+		t.Error("Failed merge modified the event")
+	}
+}
@@ -0,0 +1,154 @@
+package proio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Returns a function for writeTestEvents() that pushes the given metadata
+// before the event of each index
+func pushTestMetadata(t *testing.T, writer *Writer, metadata map[int][][2]string) func(int, *Event) {
+	return func(i int, event *Event) {
+		for _, entry := range metadata[i] {
+			if err := writer.PushMetadata(entry[0], []byte(entry[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writeTestEvents(t, writer, 4, pushTestMetadata(t, writer, map[int][][2]string{
+		0: {{"geometry", "v1"}},
+		2: {{"generator", "pythia"}, {"geometry", "v2"}},
+	}))
+	if err := writer.PushMetadata("proio.Index", nil); err != ErrReservedKey {
+		t.Errorf("Pushing reserved metadata returned %v", err)
+	}
+	stream := buffer.Bytes()
+
+	expected := []map[string][]byte{
+		{"geometry": []byte("v1")},
+		{"geometry": []byte("v1")},
+		{"geometry": []byte("v2"), "generator": []byte("pythia")},
+		{"geometry": []byte("v2"), "generator": []byte("pythia")},
+	}
+	reader := NewReader(bytes.NewReader(stream))
+	var events []*Event
+	for i := range expected {
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+		if !reflect.DeepEqual(event.Metadata, expected[i]) {
+			t.Errorf("Event %v has metadata %v", i, event.Metadata)
+		}
+	}
+	if !reflect.DeepEqual(events[0].Metadata, expected[0]) {
+		t.Error("Metadata of earlier event changed")
+	}
+	if !reflect.DeepEqual(reader.Metadata(), expected[3]) {
+		t.Errorf("Reader has metadata %v", reader.Metadata())
+	}
+
+	// Seeking reloads the metadata in effect for each event
+	reader = NewReader(bytes.NewReader(stream))
+	for _, n := range []int{3, 0, 2, 1} {
+		if err := reader.SeekToEvent(n); err != nil {
+			t.Fatal(err)
+		}
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(event.Metadata, expected[n]) {
+			t.Errorf("Event %v has metadata %v after seeking", n, event.Metadata)
+		}
+	}
+
+	// Metadata offsets survive serialization of the index, and indices
+	// without them can still be read
+	idx, _ := reader.Index()
+	if len(idx.MetadataOffsets) != 3 {
+		t.Fatalf("Index has %v metadata offsets instead of 3", len(idx.MetadataOffsets))
+	}
+	idxBuffer := &bytes.Buffer{}
+	idx.Write(idxBuffer)
+	idxIn, err := ReadIndex(bytes.NewReader(idxBuffer.Bytes()))
+	if err != nil || !reflect.DeepEqual(idxIn.MetadataOffsets, idx.MetadataOffsets) {
+		t.Errorf("Metadata offsets corrupted: %v", err)
+	}
+	oldIdx := idxBuffer.Bytes()[:idxBuffer.Len()-8-8*len(idx.MetadataOffsets)]
+	if idxIn, err = ReadIndex(bytes.NewReader(oldIdx)); err != nil || len(idxIn.Entries) != 4 {
+		t.Errorf("Failed to read index without metadata offsets: %v", err)
+	}
+}
+
+func TestMetadataConcatenation(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	for _, geometry := range []string{"a", "b"} {
+		writer := NewWriter(buffer)
+		writeTestEvents(t, writer, 1, pushTestMetadata(t, writer, map[int][][2]string{0: {{"geometry", geometry}}}))
+	}
+
+	reader := NewReader(buffer)
+	for _, geometry := range []string{"a", "b"} {
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(event.Metadata["geometry"]) != geometry {
+			t.Errorf("Event has geometry %q instead of %q", event.Metadata["geometry"], geometry)
+		}
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writeTestEvents(t, writer, 2, pushTestMetadata(t, writer, map[int][][2]string{0: {{"geometry", "v7"}}}))
+	// Metadata after the last event
+	if err := NewWriter(buffer).PushMetadata("generator", []byte("pythia")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy the stream as the tools do, with metadata carried by events
+	reader := NewReader(bytes.NewReader(buffer.Bytes()))
+	copied := &bytes.Buffer{}
+	writer = NewWriter(copied)
+	for event, _ := reader.Get(); event != nil; event, _ = reader.Get() {
+		if err := writer.UpdateMetadata(event.Metadata); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Push(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.UpdateMetadata(reader.Metadata()); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	reader = NewReader(bytes.NewReader(copied.Bytes()))
+	for event, _ := reader.Get(); event != nil; event, _ = reader.Get() {
+		if string(event.Metadata["geometry"]) != "v7" {
+			t.Errorf("Copied event has geometry %q", event.Metadata["geometry"])
+		}
+	}
+	if string(reader.Metadata()["generator"]) != "pythia" {
+		t.Error("Metadata after the last event was not copied")
+	}
+
+	// Unchanged metadata is not pushed again
+	idx, err := reader.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.MetadataOffsets) != 2 {
+		t.Errorf("Copied stream has %v metadata records", len(idx.MetadataOffsets))
+	}
+}
@@ -0,0 +1,102 @@
+package proio
+
+import (
+	"io"
+	"os"
+)
+
+// Opens an uncompressed file by mapping it into memory, and returns a new
+// Reader for it.  The payloads of events read from the Reader are slices of
+// the mapped file rather than copies, so undecoded collections of events must
+// not be accessed (or events pushed to a Writer) after the Reader is closed.
+// Collections retrieved with (*Event) Get() are always copies.  Files that are
+// compressed as a whole, as well as files that cannot be mapped, are opened
+// with Open() instead.  On platforms without mmap, the file is read into
+// memory.  The Close() function should be called when finished.
+func OpenMapped(filename string) (*Reader, error) {
+	if codecForFilename(filename) != nil {
+		return Open(filename)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if codec, seekable, err := sniffSeekable(file); err != nil || !seekable || codec != nil {
+		return Open(filename)
+	}
+	data, unmap, err := mapFile(file)
+	if err != nil {
+		return Open(filename)
+	}
+
+	reader := newReader(&mappedReader{data: data})
+	reader.deferUntilClose(unmap)
+	if err := reader.loadIndexFile(filename); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// mappedReader reads from a file that is mapped into memory
+type mappedReader struct {
+	data   []byte
+	offset int64
+}
+
+func (rdr *mappedReader) Read(p []byte) (int, error) {
+	if rdr.offset >= int64(len(rdr.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, rdr.data[rdr.offset:])
+	rdr.offset += int64(n)
+	return n, nil
+}
+
+func (rdr *mappedReader) ReadByte() (byte, error) {
+	if rdr.offset >= int64(len(rdr.data)) {
+		return 0, io.EOF
+	}
+	b := rdr.data[rdr.offset]
+	rdr.offset++
+	return b, nil
+}
+
+func (rdr *mappedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 1 /*io.SeekCurrent*/ :
+		offset += rdr.offset
+	case 2 /*io.SeekEnd*/ :
+		offset += int64(len(rdr.data))
+	}
+	if offset < 0 {
+		return rdr.offset, os.ErrInvalid
+	}
+	rdr.offset = offset
+	return offset, nil
+}
+
+// Returns up to nBytes from the current offset, without advancing it
+func (rdr *mappedReader) peek(nBytes int) []byte {
+	end := rdr.offset + int64(nBytes)
+	if end > int64(len(rdr.data)) {
+		end = int64(len(rdr.data))
+	}
+	return rdr.data[rdr.offset:end]
+}
+
+// Returns the next nBytes bytes of the file without copying them.  The slice
+// cannot be appended to in place.
+func (rdr *mappedReader) next(nBytes int) ([]byte, error) {
+	if rdr.offset+int64(nBytes) > int64(len(rdr.data)) {
+		rdr.offset = int64(len(rdr.data))
+		return nil, ErrTruncated
+	}
+	buf := rdr.data[rdr.offset : rdr.offset+int64(nBytes) : rdr.offset+int64(nBytes)]
+	rdr.offset += int64(nBytes)
+	return buf, nil
+}
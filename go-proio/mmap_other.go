@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris)
+
+package proio
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// Reads a file into memory in place of mapping it
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -2104,44 +2104,45 @@ var (
 func init() { proto.RegisterFile("proio/model/proio.proto", fileDescriptorProio) }
 
 var fileDescriptorProio = []byte{
-	// 592 bytes of a gzipped FileDescriptorProto
+	// 595 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0xc1, 0x6e, 0xd3, 0x40,
-	0x10, 0xc5, 0x71, 0x92, 0xd6, 0x63, 0x8a, 0xaa, 0x05, 0x95, 0x25, 0x82, 0x60, 0x02, 0x87, 0x20,
-	0xa8, 0x23, 0xc2, 0x01, 0x54, 0x89, 0x4b, 0x69, 0x11, 0x39, 0x14, 0xd0, 0x46, 0x3d, 0xc0, 0xcd,
+	0x10, 0xc5, 0x71, 0x92, 0xd6, 0x63, 0x0a, 0xd1, 0x82, 0xca, 0x12, 0x41, 0x30, 0x81, 0x43, 0x10,
+	0xd4, 0x11, 0xe1, 0x00, 0xaa, 0xc4, 0xa5, 0xb4, 0x88, 0x20, 0x15, 0xd0, 0x46, 0x3d, 0xc0, 0xcd,
 	0xb1, 0xa7, 0x65, 0x85, 0xbd, 0x6b, 0xd6, 0x9b, 0x4a, 0xe1, 0x4b, 0xf8, 0x09, 0xfe, 0x83, 0x23,
-	0x57, 0x6e, 0xa8, 0xfc, 0x08, 0xf2, 0x7a, 0xd3, 0xda, 0xc8, 0xbd, 0xed, 0xcc, 0xbc, 0xf7, 0x66,
-	0xf6, 0x8d, 0xbd, 0x70, 0x3b, 0x57, 0x92, 0xcb, 0x49, 0x26, 0x13, 0x4c, 0x27, 0xe6, 0x1c, 0xe6,
-	0x4a, 0x6a, 0x49, 0xfc, 0x2a, 0x30, 0x85, 0xd1, 0x6f, 0x17, 0xfc, 0xc3, 0x33, 0x14, 0xfa, 0x2d,
-	0x46, 0x09, 0x2a, 0x42, 0x61, 0xe3, 0x0c, 0x55, 0xc1, 0xa5, 0xa0, 0x4e, 0xe0, 0x8c, 0xb7, 0xd8,
-	0x3a, 0x24, 0x77, 0xc1, 0x53, 0x4b, 0xf1, 0x6e, 0x99, 0x2d, 0x50, 0xd1, 0x4e, 0xe0, 0x8c, 0xbb,
-	0xec, 0x32, 0x41, 0x02, 0xf0, 0xb1, 0x94, 0xb1, 0x75, 0xd7, 0xd4, 0xeb, 0xa9, 0x92, 0xaf, 0x79,
-	0x86, 0x73, 0x1d, 0x65, 0x39, 0xed, 0x56, 0xfc, 0x8b, 0x04, 0x19, 0xc0, 0x66, 0x82, 0x1a, 0x63,
-	0x2d, 0x15, 0xed, 0x05, 0xce, 0xd8, 0x63, 0x17, 0x31, 0x79, 0x02, 0xfd, 0x3c, 0x52, 0x51, 0x56,
-	0xd0, 0x7e, 0xe0, 0x8c, 0xfd, 0xe9, 0xcd, 0xb0, 0x76, 0x83, 0xf0, 0x83, 0x29, 0x31, 0x0b, 0x21,
-	0x1f, 0x81, 0xe4, 0xd1, 0x2a, 0x95, 0x51, 0xf2, 0x5a, 0xa6, 0x29, 0xc6, 0x9a, 0x4b, 0x51, 0xd0,
-	0x8d, 0xc0, 0x1d, 0xfb, 0xd3, 0xc7, 0x0d, 0x62, 0xed, 0xda, 0xe1, 0x25, 0xb6, 0x4a, 0xb0, 0x16,
-	0x11, 0x32, 0x04, 0x10, 0xc7, 0x82, 0x7f, 0x5d, 0xe2, 0xec, 0xa0, 0xa0, 0x9b, 0xc6, 0x9e, 0x5a,
-	0xa6, 0xf4, 0x20, 0xc1, 0x22, 0x56, 0x3c, 0x2f, 0xf1, 0x74, 0xdb, 0x5c, 0xa3, 0x9e, 0x1a, 0xa4,
-	0xb0, 0xfd, 0x7f, 0x27, 0x42, 0xa0, 0x2b, 0xa2, 0x0c, 0x8d, 0xdd, 0x1e, 0x33, 0x67, 0x72, 0x03,
-	0x3a, 0x3c, 0x31, 0x26, 0x6f, 0xb1, 0x0e, 0x4f, 0x4a, 0x8c, 0x5e, 0xe5, 0x68, 0x6c, 0xf5, 0x98,
-	0x39, 0x97, 0xdd, 0xec, 0x8c, 0x73, 0xfe, 0x0d, 0x8d, 0xa3, 0x5b, 0xac, 0x9e, 0x1a, 0x3d, 0x00,
-	0x6f, 0x26, 0x74, 0xe5, 0x0f, 0xb9, 0x05, 0xbd, 0x48, 0xa9, 0x68, 0x45, 0x9d, 0xc0, 0x1d, 0xf7,
-	0x58, 0x15, 0x8c, 0x1e, 0x82, 0xff, 0x26, 0x95, 0x51, 0x2b, 0xa8, 0xb3, 0x06, 0x3d, 0x82, 0xeb,
-	0x73, 0xad, 0xb8, 0x38, 0x6d, 0x43, 0x79, 0x6b, 0xd4, 0x0f, 0x17, 0xfa, 0x16, 0xf0, 0x0c, 0xba,
-	0x5c, 0xe8, 0xc2, 0xd4, 0xfd, 0xe9, 0xbd, 0x96, 0x75, 0x85, 0x33, 0xa1, 0x8b, 0x43, 0xa1, 0xd5,
-	0x8a, 0x19, 0x28, 0x79, 0x01, 0xfd, 0x93, 0x72, 0x90, 0x82, 0x76, 0x0c, 0xe9, 0x7e, 0x1b, 0xc9,
-	0x8c, 0x6a, 0x69, 0x16, 0x4e, 0xf6, 0x60, 0xa3, 0x30, 0xc3, 0x15, 0xd4, 0x35, 0xcc, 0xa0, 0x8d,
-	0x59, 0xcd, 0x6f, 0xa9, 0x6b, 0xc2, 0xe0, 0xbd, 0x31, 0xa8, 0xca, 0x92, 0x6d, 0x70, 0xbf, 0xe0,
-	0xca, 0xae, 0xa1, 0x3c, 0x92, 0xa7, 0xd0, 0x3b, 0x8b, 0xd2, 0x25, 0x9a, 0x45, 0xf8, 0xd3, 0x9d,
-	0x86, 0xf0, 0x85, 0xb3, 0xac, 0x02, 0xed, 0x75, 0x5e, 0x3a, 0x83, 0xb9, 0xb5, 0xf3, 0x4a, 0xc9,
-	0xb0, 0x29, 0x49, 0x1b, 0x92, 0xb5, 0x4d, 0xd4, 0x45, 0x8f, 0xd7, 0xf6, 0x5f, 0xa9, 0x3a, 0x69,
-	0xaa, 0xde, 0x69, 0xa8, 0xd6, 0x57, 0x57, 0x93, 0x1d, 0xbd, 0x02, 0x8f, 0xe1, 0x09, 0x2a, 0x14,
-	0x31, 0x92, 0x1d, 0xe8, 0xc7, 0x32, 0x4d, 0x67, 0x07, 0xf6, 0xaf, 0xb7, 0x51, 0xf9, 0x1c, 0x60,
-	0xd9, 0x74, 0x76, 0x60, 0xbf, 0xc6, 0x75, 0xb8, 0x7f, 0xf4, 0xf3, 0x7c, 0xe8, 0xfc, 0x3a, 0x1f,
-	0x3a, 0x7f, 0xce, 0x87, 0xce, 0xf7, 0xbf, 0xc3, 0x6b, 0xd0, 0x33, 0x5d, 0xf7, 0x7b, 0x47, 0x65,
-	0xdb, 0x4f, 0xbb, 0xa7, 0x5c, 0x7f, 0x5e, 0x2e, 0xc2, 0x58, 0x66, 0x93, 0x04, 0x63, 0xbe, 0xc0,
-	0x34, 0x96, 0x32, 0x47, 0x55, 0xbd, 0x45, 0x93, 0x53, 0xb9, 0x5b, 0x7b, 0xa0, 0x16, 0x7d, 0xf3,
-	0x36, 0x3d, 0xff, 0x17, 0x00, 0x00, 0xff, 0xff, 0x7c, 0x5f, 0x24, 0x3e, 0xb6, 0x04, 0x00, 0x00,
+	0x7f, 0x00, 0x2a, 0x3f, 0x82, 0xbc, 0xde, 0xb4, 0x0e, 0x72, 0x6f, 0x3b, 0x33, 0xef, 0xbd, 0x99,
+	0x7d, 0x63, 0x2f, 0xdc, 0xca, 0x95, 0xe4, 0x72, 0x9c, 0xc9, 0x04, 0xd3, 0xb1, 0x39, 0x87, 0xb9,
+	0x92, 0x5a, 0x12, 0xbf, 0x0a, 0x4c, 0x61, 0xf8, 0xdb, 0x05, 0xff, 0xe0, 0x14, 0x85, 0x7e, 0x83,
+	0x51, 0x82, 0x8a, 0x50, 0xd8, 0x38, 0x45, 0x55, 0x70, 0x29, 0xa8, 0x13, 0x38, 0xa3, 0x2d, 0xb6,
+	0x0a, 0xc9, 0x1d, 0xf0, 0xd4, 0x42, 0xbc, 0x5b, 0x64, 0x73, 0x54, 0xb4, 0x15, 0x38, 0xa3, 0x36,
+	0xbb, 0x48, 0x90, 0x00, 0x7c, 0x2c, 0x65, 0x6c, 0xdd, 0x35, 0xf5, 0x7a, 0xaa, 0xe4, 0x6b, 0x9e,
+	0xe1, 0x4c, 0x47, 0x59, 0x4e, 0xdb, 0x15, 0xff, 0x3c, 0x41, 0xfa, 0xb0, 0x99, 0xa0, 0xc6, 0x58,
+	0x4b, 0x45, 0x3b, 0x81, 0x33, 0xf2, 0xd8, 0x79, 0x4c, 0x1e, 0x43, 0x37, 0x8f, 0x54, 0x94, 0x15,
+	0xb4, 0x1b, 0x38, 0x23, 0x7f, 0x72, 0x23, 0xac, 0xdd, 0x20, 0xfc, 0x60, 0x4a, 0xcc, 0x42, 0xc8,
+	0x47, 0x20, 0x79, 0xb4, 0x4c, 0x65, 0x94, 0xbc, 0x92, 0x69, 0x8a, 0xb1, 0xe6, 0x52, 0x14, 0x74,
+	0x23, 0x70, 0x47, 0xfe, 0xe4, 0xd1, 0x1a, 0xb1, 0x76, 0xed, 0xf0, 0x02, 0x5b, 0x25, 0x58, 0x83,
+	0x08, 0x19, 0x00, 0x88, 0x23, 0xc1, 0xbf, 0x2e, 0x70, 0xba, 0x5f, 0xd0, 0x4d, 0x63, 0x4f, 0x2d,
+	0x53, 0x7a, 0x90, 0x60, 0x11, 0x2b, 0x9e, 0x97, 0x78, 0xda, 0x33, 0xd7, 0xa8, 0xa7, 0xfa, 0x29,
+	0xf4, 0xfe, 0xef, 0x44, 0x08, 0xb4, 0x45, 0x94, 0xa1, 0xb1, 0xdb, 0x63, 0xe6, 0x4c, 0xae, 0x41,
+	0x8b, 0x27, 0xc6, 0xe4, 0x2d, 0xd6, 0xe2, 0x49, 0x89, 0xd1, 0xcb, 0x1c, 0x8d, 0xad, 0x1e, 0x33,
+	0xe7, 0xb2, 0x9b, 0x9d, 0x71, 0xc6, 0xbf, 0xa1, 0x71, 0x74, 0x8b, 0xd5, 0x53, 0x6f, 0xdb, 0x9b,
+	0xd7, 0x7b, 0xbd, 0xe1, 0x7d, 0xf0, 0xa6, 0x42, 0x57, 0x2e, 0x91, 0x9b, 0xd0, 0x89, 0x94, 0x8a,
+	0x96, 0xd4, 0x09, 0xdc, 0x51, 0x87, 0x55, 0xc1, 0xf0, 0x01, 0xf8, 0xaf, 0x53, 0x19, 0x35, 0x82,
+	0x5a, 0x2b, 0xd0, 0x43, 0xb8, 0x3a, 0xd3, 0x8a, 0x8b, 0x93, 0x26, 0x94, 0xb7, 0x42, 0xfd, 0x70,
+	0xa1, 0x6b, 0x01, 0x4f, 0xa1, 0xcd, 0x85, 0x2e, 0x4c, 0xdd, 0x9f, 0xdc, 0x6d, 0x58, 0x5a, 0x38,
+	0x15, 0xba, 0x38, 0x10, 0x5a, 0x2d, 0x99, 0x81, 0x92, 0xe7, 0xd0, 0x3d, 0x2e, 0x07, 0x29, 0x68,
+	0xcb, 0x90, 0xee, 0x35, 0x91, 0xcc, 0xa8, 0x96, 0x66, 0xe1, 0x64, 0x17, 0x36, 0x0a, 0x33, 0x5c,
+	0x41, 0x5d, 0xc3, 0x0c, 0x9a, 0x98, 0xd5, 0xfc, 0x96, 0xba, 0x22, 0xf4, 0xdf, 0x1b, 0x83, 0xaa,
+	0x2c, 0xe9, 0x81, 0xfb, 0x05, 0x97, 0x76, 0x19, 0xe5, 0x91, 0x3c, 0x81, 0xce, 0x69, 0x94, 0x2e,
+	0xd0, 0xac, 0xc3, 0x9f, 0x6c, 0xaf, 0x09, 0x9f, 0x3b, 0xcb, 0x2a, 0xd0, 0x6e, 0xeb, 0x85, 0xd3,
+	0x9f, 0x59, 0x3b, 0x2f, 0x95, 0x0c, 0xd7, 0x25, 0xe9, 0x9a, 0x64, 0x6d, 0x13, 0x75, 0xd1, 0xa3,
+	0x95, 0xfd, 0x97, 0xaa, 0x8e, 0xd7, 0x55, 0x6f, 0xaf, 0xa9, 0xd6, 0x57, 0x57, 0x93, 0x1d, 0xbe,
+	0x04, 0x8f, 0xe1, 0x31, 0x2a, 0x14, 0x31, 0x92, 0x6d, 0xe8, 0xc6, 0x32, 0x4d, 0xa7, 0xfb, 0xf6,
+	0xdf, 0xb7, 0x51, 0xf9, 0x28, 0x60, 0xd9, 0x74, 0xba, 0x6f, 0xbf, 0xc9, 0x55, 0xb8, 0x77, 0xf8,
+	0xf3, 0x6c, 0xe0, 0xfc, 0x3a, 0x1b, 0x38, 0x7f, 0xce, 0x06, 0xce, 0xf7, 0xbf, 0x83, 0x2b, 0xd0,
+	0x31, 0x5d, 0xf7, 0x3a, 0x87, 0x65, 0xdb, 0x4f, 0x3b, 0x27, 0x5c, 0x7f, 0x5e, 0xcc, 0xc3, 0x58,
+	0x66, 0xe3, 0x04, 0x63, 0x3e, 0xc7, 0x34, 0x96, 0x32, 0x47, 0x55, 0xbd, 0x48, 0xe3, 0x13, 0xb9,
+	0x53, 0x7b, 0xa6, 0xe6, 0x5d, 0xf3, 0x42, 0x3d, 0xfb, 0x37, 0x00, 0x5d, 0x9f, 0xa5, 0x3b, 0xbc,
+	0x04, 0x00, 0x00,
 }
 
 // Extra generated functions for compliance with Message and Collection interfaces
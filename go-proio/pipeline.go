@@ -0,0 +1,185 @@
+package proio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// A Processor operates on a single event, and returns the event to pass on to
+// the next Processor (typically the same event, modified).  Returning a nil
+// event drops it from the output.
+type Processor func(*Event) (*Event, error)
+
+// Pipeline reads events from a Reader, runs each of them through a chain of
+// Processors on a pool of worker goroutines, and pushes the results to a
+// Writer in the same order that the events were read.  Since events are
+// processed concurrently, Processors must not share unsynchronized state.
+type Pipeline struct {
+	Reader     *Reader
+	Writer     *Writer
+	Processors []Processor
+
+	// Workers is the number of goroutines running Processors.  If it is not
+	// positive, runtime.NumCPU() is used.
+	Workers int
+
+	// MaxErrors is the number of Processor errors tolerated before the
+	// Pipeline is stopped.  Events that fail processing are dropped from the
+	// output.  With the default of zero, the first error stops the Pipeline.
+	MaxErrors int
+}
+
+// Returns a new Pipeline.  The Writer may be nil, in which case processed
+// events are discarded.
+func NewPipeline(reader *Reader, writer *Writer, processors ...Processor) *Pipeline {
+	return &Pipeline{
+		Reader:     reader,
+		Writer:     writer,
+		Processors: processors,
+	}
+}
+
+// EventError associates an error with the event that caused it.  Event is the
+// ordinal of the event in the input stream, counting from zero.
+type EventError struct {
+	Event int
+	Err   error
+}
+
+func (err *EventError) Error() string {
+	return fmt.Sprint("event ", err.Event, ": ", err.Err)
+}
+
+// PipelineErrors aggregates all errors encountered during a (*Pipeline) Run()
+type PipelineErrors []error
+
+func (errs PipelineErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type pipelineJob struct {
+	ordinal int
+	event   *Event
+	result  chan *Event
+	err     error
+}
+
+// Run processes events until the Reader is exhausted, too many errors occur,
+// writing fails, or the context is canceled.  Stopping is graceful: events
+// that have already been read are still processed and written in order before
+// Run returns.  The returned error is nil or of type PipelineErrors, which
+// includes the context error if the context was canceled.  Reader errors other
+// than io.EOF are included as well.
+func (pl *Pipeline) Run(ctx context.Context) error {
+	workers := pl.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	jobs := make(chan *pipelineJob, workers)
+	ordered := make(chan *pipelineJob, 2*workers)
+	readErrs := make(chan PipelineErrors, 1)
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+
+		var errs PipelineErrors
+		defer func() {
+			readErrs <- errs
+		}()
+
+		for ordinal := 0; ; ordinal++ {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			event, err := pl.Reader.Get()
+			if err != nil && err != io.EOF {
+				errs = append(errs, &EventError{Event: ordinal, Err: err})
+			}
+			if event == nil {
+				return
+			}
+
+			job := &pipelineJob{
+				ordinal: ordinal,
+				event:   event,
+				result:  make(chan *Event, 1),
+			}
+			ordered <- job
+			jobs <- job
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				event := job.event
+				for _, process := range pl.Processors {
+					if event, job.err = process(event); job.err != nil || event == nil {
+						event = nil
+						break
+					}
+				}
+				job.result <- event
+			}
+		}()
+	}
+
+	var errs PipelineErrors
+	nProcessErrs := 0
+	for job := range ordered {
+		event := <-job.result
+		if job.err != nil {
+			errs = append(errs, &EventError{Event: job.ordinal, Err: job.err})
+			nProcessErrs++
+			if nProcessErrs > pl.MaxErrors {
+				cancel()
+			}
+			continue
+		}
+
+		if event != nil && pl.Writer != nil {
+			if err := pl.Writer.Push(event); err != nil {
+				errs = append(errs, &EventError{Event: job.ordinal, Err: err})
+				cancel()
+				// Drain the remaining jobs so that the reading goroutine
+				// can finish
+				for range ordered {
+				}
+				break
+			}
+		}
+	}
+
+	if readErrs := <-readErrs; len(readErrs) > 0 {
+		errs = append(readErrs, errs...)
+	}
+	if pl.Writer != nil {
+		if err := pl.Writer.Flush(); err != nil && len(errs) == 0 {
+			errs = append(errs, err)
+		}
+	}
+	if err := parent.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
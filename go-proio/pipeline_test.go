@@ -0,0 +1,114 @@
+package proio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func pipelineTestStream(t *testing.T, nEvents int) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), nEvents, nil)
+	return buffer
+}
+
+func TestPipeline(t *testing.T) {
+	output := &bytes.Buffer{}
+	pipeline := NewPipeline(
+		NewReader(pipelineTestStream(t, 100)),
+		NewWriter(output),
+		func(event *Event) (*Event, error) {
+			if event.Header.EventNumber%10 == 0 {
+				return nil, nil
+			}
+			return event, nil
+		},
+		func(event *Event) (*Event, error) {
+			part := event.Get("MCParticles").GetEntry(0).(*prolcio.MCParticle)
+			part.PDG = -part.PDG
+			return event, nil
+		},
+	)
+	pipeline.Workers = 4
+	if err := pipeline.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewReader(output)
+	nEvents := 0
+	for event := range reader.ScanEvents() {
+		eventNumber := event.Header.EventNumber
+		if eventNumber%10 == 0 || eventNumber != uint64(nEvents+nEvents/9+1) {
+			t.Fatalf("Event %v is out of order", eventNumber)
+		}
+		part := event.Get("MCParticles").GetEntry(0).(*prolcio.MCParticle)
+		if part.PDG != -int32(eventNumber) {
+			t.Error("Event was not processed")
+		}
+		nEvents++
+	}
+	if nEvents != 90 {
+		t.Errorf("%v events written instead of 90", nEvents)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	errOdd := errors.New("odd event")
+	pipeline := NewPipeline(
+		NewReader(pipelineTestStream(t, 20)),
+		nil,
+		func(event *Event) (*Event, error) {
+			if event.Header.EventNumber%2 == 1 {
+				return nil, errOdd
+			}
+			return event, nil
+		},
+	)
+	pipeline.MaxErrors = 100
+	err := pipeline.Run(context.Background())
+	errs, ok := err.(PipelineErrors)
+	if !ok || len(errs) != 10 {
+		t.Fatalf("Run returned %v", err)
+	}
+	for i, err := range errs {
+		eventErr, ok := err.(*EventError)
+		if !ok || eventErr.Event != 2*i+1 || eventErr.Err != errOdd {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	output := &bytes.Buffer{}
+	pipeline := NewPipeline(
+		NewReader(pipelineTestStream(t, 1000)),
+		NewWriter(output),
+		func(event *Event) (*Event, error) {
+			if event.Header.EventNumber == 10 {
+				cancel()
+			}
+			return event, nil
+		},
+	)
+	pipeline.Workers = 2
+	err := pipeline.Run(ctx)
+	if errs, ok := err.(PipelineErrors); !ok || errs[len(errs)-1] != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	reader := NewReader(output)
+	nEvents := 0
+	for event := range reader.ScanEvents() {
+		if event.Header.EventNumber != uint64(nEvents) {
+			t.Fatalf("Event %v is out of order", event.Header.EventNumber)
+		}
+		nEvents++
+	}
+	if nEvents <= 10 || nEvents >= 1000 {
+		t.Errorf("%v events written after cancellation", nEvents)
+	}
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 
@@ -12,8 +12,9 @@ import (
 )
 
 var (
-	doGzip = flag.Bool("g", false, "decompress the stdin input with gzip")
+	doGzip = flag.Bool("g", false, "ignored; compression of the stdin input is detected automatically")
 	event  = flag.Int("e", -1, "list specified event, numbered consecutively from the start of the file or stream")
+	index  = flag.Bool("i", false, "create a sidecar index file for fast random access with -e")
 )
 
 func printUsage() {
@@ -39,12 +40,7 @@ func main() {
 
 	filename := flag.Arg(0)
 	if filename == "-" {
-		stdin := bufio.NewReader(os.Stdin)
-		if *doGzip {
-			reader, err = proio.NewGzipReader(stdin)
-		} else {
-			reader = proio.NewReader(stdin)
-		}
+		reader = proio.NewReader(bufio.NewReader(os.Stdin))
 	} else {
 		reader, err = proio.Open(filename)
 	}
@@ -52,11 +48,32 @@ func main() {
 		log.Fatal(err)
 	}
 	defer reader.Close()
+	reader.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	reader.ReadOnly = true
+
+	if *index {
+		if filename == "-" {
+			log.Fatal("Cannot create an index for stdin")
+		}
+		idx, err := reader.Index()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := idx.WriteFile(proio.IndexFilename(filename)); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	singleEvent := false
 	if *event >= 0 {
 		singleEvent = true
-		_, err = reader.Skip(*event)
+		// Building an index would scan the whole stream, which is more
+		// costly than skipping to a single event
+		if reader.AvailableIndex() != nil {
+			err = reader.SeekToEvent(*event)
+		} else {
+			_, err = reader.Skip(*event)
+		}
 		if err == proio.ErrResync {
 			log.Print(err)
 		} else if err != nil {
@@ -64,27 +81,15 @@ func main() {
 		}
 	}
 
-	nEventsRead := 0
+	for reader.Next(context.Background()) {
+		fmt.Print(reader.Event())
+		reader.Event().Release()
 
-	for event := range reader.ScanEvents() {
-		fmt.Print(event)
-
-		nEventsRead++
 		if singleEvent {
-			reader.StopScan()
 			break
 		}
 	}
-
-errLoop:
-	for {
-		select {
-		case err := <-reader.Err:
-			if err != io.EOF || nEventsRead == 0 {
-				log.Print(err)
-			}
-		default:
-			break errLoop
-		}
+	if err := reader.Err(); err != nil {
+		log.Print(err)
 	}
 }
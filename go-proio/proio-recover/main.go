@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/decibelcooper/proio/go-proio"
+)
+
+var (
+	outFile = flag.String("o", "", "file to save salvaged events to (stdout by default)")
+	quiet   = flag.Bool("q", false, "only report totals, rather than each byte range lost")
+)
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage: proio-recover [options] <damaged-proio-file>
+Salvages every readable event from a damaged file, writing them out
+unchanged, and reports the byte ranges of the file that were lost.  Files
+must be seekable, so compressed files must be gzip files written in blocks
+(see proio-strip -b), in which case byte ranges are given as virtual offsets.
+options:
+`,
+	)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		printUsage()
+		log.Fatal("Invalid arguments")
+	}
+
+	reader, err := proio.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+	reader.ReadOnly = true
+	reader.Recover = true
+
+	nRanges := 0
+	nBytes := int64(0)
+	reader.LostBytes = func(start, end int64) {
+		nRanges++
+		nBytes += end - start
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "lost bytes %v to %v (%v bytes)\n", start, end, end-start)
+		}
+	}
+
+	var writer *proio.Writer
+	if *outFile == "" {
+		writer = proio.NewWriter(os.Stdout)
+	} else {
+		writer, err = proio.Create(*outFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	nEvents := 0
+	for {
+		event, err := reader.Get()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != proio.ErrResync {
+			log.Fatal(err)
+		}
+
+		if err := writer.UpdateMetadata(event.Metadata); err != nil {
+			log.Fatal(err)
+		}
+		if err := writer.Push(event); err != nil {
+			log.Fatal(err)
+		}
+		event.Release()
+		nEvents++
+	}
+	// Metadata after the last event
+	if err := writer.UpdateMetadata(reader.Metadata()); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "salvaged %v events, lost %v bytes in %v ranges\n", nEvents, nBytes, nRanges)
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 
@@ -14,8 +14,13 @@ import (
 var (
 	outFile    = flag.String("o", "", "file to save output to")
 	keep       = flag.Bool("k", false, "keep only the specified collections, rather than stripping them away")
-	decompress = flag.Bool("d", false, "decompress the stdin input with gzip")
+	decompress = flag.Bool("d", false, "ignored; compression of the stdin input is detected automatically")
 	compress   = flag.Bool("c", false, "compress the stdout output with gzip")
+	blockSize  = flag.Int("b", 0, "split gzip output into independently compressed blocks of about this many bytes, so that it can be indexed and seeked")
+	compact    = flag.String("r", "", "renumber unique IDs densely after stripping, and keep, null or drop references into stripped collections (one of keep, null or drop)")
+	payload    = flag.String("p", "", "compress each event payload independently with the named codec (gzip, zstd, lz4 or xz), keeping the output seekable")
+	checksums  = flag.Bool("s", false, "write checksums with each event, so that corruption can be detected")
+	trailer    = flag.Bool("t", false, "append a trailer holding the event count, runs, bytes per collection type and an index, so that uncompressed output can be summarized and seeked without scanning")
 )
 
 func printUsage() {
@@ -41,19 +46,16 @@ func main() {
 
 	filename := flag.Arg(0)
 	if filename == "-" {
-		stdin := bufio.NewReader(os.Stdin)
-		if *decompress {
-			reader, err = proio.NewGzipReader(stdin)
-		} else {
-			reader = proio.NewReader(stdin)
-		}
+		reader = proio.NewReader(bufio.NewReader(os.Stdin))
 	} else {
-		reader, err = proio.Open(filename)
+		reader, err = proio.OpenMapped(filename)
 	}
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer reader.Close()
+	reader.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	reader.ReadOnly = true
 
 	var writer *proio.Writer
 	if *outFile == "" {
@@ -68,16 +70,40 @@ func main() {
 			log.Fatal(err)
 		}
 	}
-	defer writer.Close()
+
+	writer.GzipBlockSize = *blockSize
+	writer.Checksums = *checksums
+	writer.Trailer = *trailer
+	if *payload != "" {
+		writer.PayloadCodec = proio.GetCodec(*payload)
+		if writer.PayloadCodec == nil {
+			log.Fatal("Unknown codec: ", *payload)
+		}
+	}
+
+	var dangling proio.DanglingRefs
+	switch *compact {
+	case "", "keep":
+		dangling = proio.KeepDanglingRefs
+	case "null":
+		dangling = proio.NullDanglingRefs
+	case "drop":
+		dangling = proio.DropDanglingRefs
+	default:
+		printUsage()
+		log.Fatal("Invalid value for -r: ", *compact)
+	}
 
 	var colls []string
 	for i := 1; i < flag.NArg(); i++ {
 		colls = append(colls, flag.Arg(i))
 	}
 
-	nEventsRead := 0
-
-	for event := range reader.ScanEvents() {
+	for reader.Next(context.Background()) {
+		event := reader.Event()
+		if err := writer.UpdateMetadata(event.Metadata); err != nil {
+			log.Fatal(err)
+		}
 		for _, collName := range event.GetNames() {
 			if *keep {
 				keepThis := false
@@ -99,22 +125,26 @@ func main() {
 			}
 		}
 
+		if *compact != "" {
+			if err := event.Compact(dangling); err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		if err := writer.Push(event); err != nil {
 			log.Fatal(err)
 		}
-
-		nEventsRead++
+		event.Release()
+	}
+	if err := reader.Err(); err != nil {
+		log.Print(err)
+	}
+	// Metadata after the last event
+	if err := writer.UpdateMetadata(reader.Metadata()); err != nil {
+		log.Fatal(err)
 	}
 
-errLoop:
-	for {
-		select {
-		case err := <-reader.Err:
-			if err != io.EOF || nEventsRead == 0 {
-				log.Print(err)
-			}
-		default:
-			break errLoop
-		}
+	if err := writer.Close(); err != nil {
+		log.Fatal(err)
 	}
 }
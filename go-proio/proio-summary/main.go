@@ -15,7 +15,8 @@ import (
 )
 
 var (
-	doGzip = flag.Bool("g", false, "decompress the stdin input with gzip")
+	doGzip = flag.Bool("g", false, "ignored; compression of the stdin input is detected automatically")
+	doScan = flag.Bool("s", false, "scan every event header even if the file has a trailer")
 )
 
 func printUsage() {
@@ -41,12 +42,7 @@ func main() {
 
 	filename := flag.Arg(0)
 	if filename == "-" {
-		stdin := bufio.NewReader(os.Stdin)
-		if *doGzip {
-			reader, err = proio.NewGzipReader(stdin)
-		} else {
-			reader = proio.NewReader(stdin)
-		}
+		reader = proio.NewReader(bufio.NewReader(os.Stdin))
 	} else {
 		reader, err = proio.Open(filename)
 	}
@@ -55,8 +51,14 @@ func main() {
 	}
 	defer reader.Close()
 
+	if !*doScan {
+		if summary, err := reader.Summary(); err == nil {
+			printSummary(len(summary.Runs), int(summary.NEvents), summary.TypeBytes)
+			return
+		}
+	}
+
 	nEvents := 0
-	colls := make([]string, 0)
 	collBytes := make(map[string]uint64)
 	runs := make(map[uint64]bool)
 
@@ -70,10 +72,6 @@ func main() {
 		nEvents++
 
 		for _, collHdr := range header.PayloadCollections {
-			if _, ok := collBytes[collHdr.Type]; !ok {
-				colls = append(colls, collHdr.Type)
-				sort.Strings(colls)
-			}
 			collBytes[collHdr.Type] += uint64(collHdr.PayloadSize)
 		}
 	}
@@ -82,7 +80,17 @@ func main() {
 		log.Print(err)
 	}
 
-	fmt.Println("Number of runs:", len(runs))
+	printSummary(len(runs), nEvents, collBytes)
+}
+
+func printSummary(nRuns, nEvents int, collBytes map[string]uint64) {
+	colls := make([]string, 0, len(collBytes))
+	for key := range collBytes {
+		colls = append(colls, key)
+	}
+	sort.Strings(colls)
+
+	fmt.Println("Number of runs:", nRuns)
 	fmt.Println("Number of events:", nEvents)
 	fmt.Println("Total bytes for...")
 	for _, key := range colls {
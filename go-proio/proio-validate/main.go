@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/decibelcooper/proio/go-proio"
+)
+
+var (
+	maxProblems = flag.Int("m", 0, "stop after reporting this many problems (0 for no limit)")
+	quiet       = flag.Bool("q", false, "only report the number of problems found")
+)
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage: proio-validate [options] <proio-input-files>...
+Checks events for dangling references, duplicate IDs, IDs exceeding the
+number of unique IDs in the event header, payload size mismatches, checksum
+mismatches, and events of newer format versions than are supported, and exits
+with a non-zero status if any problems are found.
+options:
+`,
+	)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		printUsage()
+		log.Fatal("Invalid arguments")
+	}
+
+	nProblems := 0
+	for _, filename := range flag.Args() {
+		nProblems += validate(filename)
+		if *maxProblems > 0 && nProblems >= *maxProblems {
+			break
+		}
+	}
+
+	if nProblems > 0 {
+		fmt.Println("Problems found:", nProblems)
+		os.Exit(1)
+	}
+}
+
+func validate(filename string) int {
+	var reader *proio.Reader
+	var err error
+	if filename == "-" {
+		reader = proio.NewReader(bufio.NewReader(os.Stdin))
+	} else {
+		reader, err = proio.Open(filename)
+	}
+	if err != nil {
+		fmt.Print(filename, ": ", err, "\n")
+		return 1
+	}
+	defer reader.Close()
+
+	nProblems := 0
+	report := func(msg ...interface{}) {
+		nProblems++
+		if !*quiet {
+			fmt.Print(filename, ": ")
+			fmt.Println(msg...)
+		}
+	}
+
+	nEvents := 0
+	for {
+		event, err := reader.Get()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report(fmt.Sprint("event ", nEvents, ":"), err)
+			// Events that fail their checksums or are of newer format
+			// versions are skipped over, but other errors leave nothing
+			// more to read
+			if event == nil && err != proio.ErrChecksum && err != proio.ErrUnsupportedVersion {
+				break
+			}
+		}
+
+		if event != nil {
+			if err := event.Validate(); err != nil {
+				for _, err := range err.(proio.ValidationErrors) {
+					report(fmt.Sprint("event ", nEvents, ":"), err)
+				}
+			}
+		}
+		nEvents++
+
+		if *maxProblems > 0 && nProblems >= *maxProblems {
+			return nProblems
+		}
+	}
+
+	return nProblems
+}
@@ -2,15 +2,62 @@ package proio // import "github.com/decibelcooper/proio/go-proio"
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
 	"math"
 	"reflect"
+	"runtime"
 	"testing"
 
 	"go-hep.org/x/hep/lcio"
 
+	"github.com/decibelcooper/proio/go-proio/model"
 	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
 )
 
+// Pushes nEvents events to the writer and closes it.  Event i is numbered i
+// and holds an MCParticles collection with a single MCParticle of PDG i, and
+// is passed to modify, if not nil, before it is pushed.
+func writeTestEvents(t *testing.T, writer *Writer, nEvents int, modify func(i int, event *Event)) {
+	for i := 0; i < nEvents; i++ {
+		event := NewEvent()
+		event.Header.EventNumber = uint64(i)
+		event.Add(&prolcio.MCParticleCollection{Entries: []*prolcio.MCParticle{{PDG: int32(i)}}}, "MCParticles")
+		if modify != nil {
+			modify(i, event)
+		}
+		if err := writer.Push(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Checks that the reader holds exactly the events written by
+// writeTestEvents()
+func checkTestEvents(t *testing.T, reader *Reader, nEvents int, name string) {
+	for i := 0; i < nEvents; i++ {
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if event.Header.EventNumber != uint64(i) {
+			t.Errorf("%v: got event %v instead of %v", name, event.Header.EventNumber, i)
+		}
+		MCParticles := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+		if len(MCParticles.Entries) != 1 || MCParticles.Entries[0].PDG != int32(i) {
+			t.Errorf("%v: event %v has wrong contents", name, i)
+		}
+	}
+	if event, _ := reader.Get(); event != nil {
+		t.Errorf("%v: read extra event", name)
+	}
+}
+
 func TestEventPushGet(t *testing.T) {
 	buffer := &bytes.Buffer{}
 
@@ -229,6 +276,507 @@ func TestRefDeref3(t *testing.T) {
 	}
 }
 
+func TestGetE(t *testing.T) {
+	event := NewEvent()
+	event.Header.PayloadCollections = []*model.EventHeader_CollectionHeader{
+		{Name: "Unknown", Type: "unknown.Collection", PayloadSize: 2},
+		{Name: "Corrupt", Type: "lcio.MCParticleCollection", PayloadSize: 2},
+	}
+	event.setPayload([]byte{0x08, 0x01, 0xff, 0xff})
+	logBuffer := &bytes.Buffer{}
+	event.Logger = log.New(logBuffer, "", 0)
+
+	if _, err := event.GetE("Missing"); err != ErrNoSuchCollection {
+		t.Errorf("Getting a missing collection returned %v", err)
+	}
+	if _, err := event.GetE("Unknown"); err != ErrUnknownType {
+		t.Errorf("Getting a collection of unknown type returned %v", err)
+	}
+	if _, err := event.GetE("Corrupt"); err != ErrCorruptCollection {
+		t.Errorf("Getting a corrupt collection returned %v", err)
+	}
+	if _, err := event.DereferenceE(&model.Reference{CollID: 1}); err != ErrDanglingRef {
+		t.Errorf("Dereferencing a missing collection returned %v", err)
+	}
+
+	if logBuffer.Len() != 0 {
+		t.Errorf("GetE() logged %q", logBuffer.String())
+	}
+	if event.Get("Missing") != nil || event.Get("Corrupt") != nil {
+		t.Error("Get() returned a collection")
+	}
+	if logBuffer.String() != "failed to get collection Corrupt: "+ErrCorruptCollection.Error()+"\n" {
+		t.Errorf("Get() logged %q", logBuffer.String())
+	}
+}
+
+func TestRefIndex(t *testing.T) {
+	event := NewEvent()
+
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	part1 := &prolcio.MCParticle{PDG: 11}
+	MCParticles.Entries = append(MCParticles.Entries, part1)
+	ref1 := event.Reference(part1)
+	if event.Dereference(ref1) != part1 {
+		t.Error("Failed to dereference first particle")
+	}
+
+	// Entries appended after the index was built must still be found
+	part2 := &prolcio.MCParticle{PDG: 22}
+	MCParticles.Entries = append(MCParticles.Entries, part2)
+	ref2 := event.Reference(part2)
+	if ref2 == nil || event.Dereference(ref2) != part2 {
+		t.Error("Failed to dereference appended particle")
+	}
+	if event.Dereference(&model.Reference{CollID: ref1.CollID}) != MCParticles {
+		t.Error("Failed to dereference collection")
+	}
+
+	if _, err := event.DereferenceE(&model.Reference{CollID: ref1.CollID, EntryID: 1000}); err != ErrDanglingRef {
+		t.Errorf("Dereferencing dangling reference returned %v", err)
+	}
+
+	// Appended entries extend the index rather than rebuilding it
+	refs := event.refs
+	part3 := &prolcio.MCParticle{PDG: 13}
+	MCParticles.Entries = append(MCParticles.Entries, part3)
+	if ref3 := event.Reference(part3); ref3 == nil || event.Dereference(ref3) != part3 {
+		t.Error("Failed to dereference appended particle")
+	}
+	if event.refs != refs {
+		t.Error("Reference index was rebuilt")
+	}
+
+	// Entries replaced or removed in place must be noticed
+	part4 := &prolcio.MCParticle{PDG: 211}
+	MCParticles.Entries[1] = part4
+	ref4 := event.Reference(part4)
+	if ref4 == nil || event.Dereference(ref4) != part4 {
+		t.Error("Failed to dereference replacing particle")
+	}
+	if event.Dereference(ref2) != nil {
+		t.Error("Dereferenced replaced particle")
+	}
+	if event.Reference(part2) != nil {
+		t.Error("Referenced replaced particle")
+	}
+	MCParticles.Entries = MCParticles.Entries[:1]
+	if event.Dereference(ref4) != nil {
+		t.Error("Dereferenced removed particle")
+	}
+	if event.Dereference(ref1) != part1 {
+		t.Error("Failed to dereference first particle")
+	}
+
+	event.Remove("MCParticles")
+	if event.Dereference(ref1) != nil {
+		t.Error("Dereferenced particle of removed collection")
+	}
+	if event.Reference(part1) != nil {
+		t.Error("Referenced particle of removed collection")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: 11})
+	event.Add(MCParticles, "MCParticles")
+	simTrackHits := &prolcio.SimTrackerHitCollection{}
+	simTrackHits.Entries = append(simTrackHits.Entries, &prolcio.SimTrackerHit{})
+	event.Add(simTrackHits, "TrackerHits")
+	writer.Push(event)
+	writer.Close()
+	original := append([]byte(nil), buffer.Bytes()...)
+
+	reader := NewReader(bytes.NewReader(original))
+	reader.ReadOnly = true
+	event, err := reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nColls := len(event.Header.PayloadCollections)
+	payloadSize := len(event.payload)
+	MCParticlesIn, ok := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+	if !ok || MCParticlesIn.Entries[0].PDG != 11 {
+		t.Fatal("Failed to get MCParticles")
+	}
+	if event.Get("MCParticles") != MCParticlesIn {
+		t.Error("Collection decoded twice")
+	}
+	if len(event.Header.PayloadCollections) != nColls || len(event.payload) != payloadSize {
+		t.Error("ReadOnly Get() removed collection from payload")
+	}
+
+	buffer.Reset()
+	writer = NewWriter(buffer)
+	writer.Push(event)
+	writer.Close()
+	if !bytes.Equal(buffer.Bytes(), original) {
+		t.Error("Untouched event not written verbatim")
+	}
+
+	event.MarkDirty("MCParticles")
+	MCParticlesIn.Entries[0].PDG = 22
+	if event.Get("MCParticles") != MCParticlesIn {
+		t.Error("MarkDirty() lost collection")
+	}
+	buffer.Reset()
+	writer = NewWriter(buffer)
+	writer.Push(event)
+	writer.Close()
+
+	reader = NewReader(buffer)
+	event, err = reader.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	MCParticlesIn, ok = event.Get("MCParticles").(*prolcio.MCParticleCollection)
+	if !ok || MCParticlesIn.Entries[0].PDG != 22 {
+		t.Error("Dirty collection not reserialized")
+	}
+	if event.Get("TrackerHits") == nil {
+		t.Error("Failed to get untouched collection")
+	}
+
+	// Assigning IDs to a ReadOnly collection marks it dirty
+	reader = NewReader(bytes.NewReader(original))
+	reader.ReadOnly = true
+	event, _ = reader.Get()
+	hits := event.Get("TrackerHits").(*prolcio.SimTrackerHitCollection)
+	ref := event.Reference(hits.Entries[0])
+	buffer.Reset()
+	writer = NewWriter(buffer)
+	writer.Push(event)
+	writer.Close()
+	event, _ = NewReader(buffer).Get()
+	if event.Dereference(ref) == nil {
+		t.Error("Reference into ReadOnly collection not written")
+	}
+}
+
+func TestCollectionOrder(t *testing.T) {
+	event := NewEvent()
+	for _, name := range []string{"C", "A", "B"} {
+		event.Add(&prolcio.MCParticleCollection{}, name)
+	}
+	if names := event.GetNames(); !reflect.DeepEqual(names, []string{"C", "A", "B"}) {
+		t.Errorf("Names not in insertion order: %v", names)
+	}
+
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.Push(event)
+	writer.Close()
+	original := append([]byte(nil), buffer.Bytes()...)
+
+	// Getting collections must not reorder them
+	event, _ = NewReader(bytes.NewReader(original)).Get()
+	event.Get("A")
+	event.Get("C")
+	if names := event.GetNames(); !reflect.DeepEqual(names, []string{"C", "A", "B"}) {
+		t.Errorf("Get() reordered names: %v", names)
+	}
+	buffer.Reset()
+	writer = NewWriter(buffer)
+	writer.Push(event)
+	writer.Push(event)
+	writer.Close()
+	if !bytes.Equal(buffer.Bytes(), append(append([]byte(nil), original...), original...)) {
+		t.Error("Output not reproducible")
+	}
+
+	if err := event.MoveCollection("B", 0); err != nil {
+		t.Error(err)
+	}
+	if names := event.GetNames(); !reflect.DeepEqual(names, []string{"B", "C", "A"}) {
+		t.Errorf("MoveCollection() to front gave %v", names)
+	}
+	event.Get("B")
+	if err := event.MoveCollection("B", 10); err != nil {
+		t.Error(err)
+	}
+	if names := event.GetNames(); !reflect.DeepEqual(names, []string{"C", "A", "B"}) {
+		t.Errorf("MoveCollection() to back gave %v", names)
+	}
+	if err := event.MoveCollection("D", 0); err != ErrNoSuchCollection {
+		t.Errorf("Moving a missing collection returned %v", err)
+	}
+
+	event.SortCollections(nil)
+	event.Get("C")
+	event.Remove("C")
+	buffer.Reset()
+	writer = NewWriter(buffer)
+	writer.Push(event)
+	writer.Close()
+	event, _ = NewReader(buffer).Get()
+	if names := event.GetNames(); !reflect.DeepEqual(names, []string{"A", "B"}) {
+		t.Errorf("Sorted event read back with names %v", names)
+	}
+
+	// Sizes in the header that exceed the payload are reported, not followed
+	event = NewEvent()
+	event.Header.PayloadCollections = append(event.Header.PayloadCollections,
+		&model.EventHeader_CollectionHeader{Name: "A", Type: "lcio.MCParticleCollection", PayloadSize: 100})
+	event.setPayload(make([]byte, 46))
+	event.Add(&prolcio.MCParticleCollection{}, "B")
+	if err := NewWriter(ioutil.Discard).Push(event); err != ErrCorruptCollection {
+		t.Errorf("Pushing an event with a corrupted header returned %v", err)
+	}
+}
+
+func TestReferrersOf(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+
+	eventOut := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	eventOut.Add(MCParticles, "MCParticles")
+	part1 := &prolcio.MCParticle{PDG: 11}
+	part2 := &prolcio.MCParticle{PDG: 22}
+	MCParticles.Entries = append(MCParticles.Entries, part1, part2)
+
+	TrackerHits := &prolcio.SimTrackerHitCollection{}
+	eventOut.Add(TrackerHits, "TrackerHits")
+	for i := 0; i < 3; i++ {
+		TrackerHits.Entries = append(TrackerHits.Entries, &prolcio.SimTrackerHit{Mc: eventOut.Reference(part1)})
+	}
+	part2.Parents = append(part2.Parents, eventOut.Reference(part1))
+	eventOut.Add(&prolcio.TrackerRawDataCollection{Entries: []*prolcio.TrackerRawData{{CellID0: 1}}}, "RawData")
+	Tracks := &prolcio.TrackCollection{}
+	eventOut.Add(Tracks, "Tracks")
+	Tracks.Entries = append(Tracks.Entries, &prolcio.Track{Hits: []*model.Reference{eventOut.Reference(TrackerHits.Entries[0])}})
+	writer.Push(eventOut)
+
+	reader := NewReader(buffer)
+	eventIn, _ := reader.Get()
+	part1 = eventIn.Get("MCParticles").GetEntry(0).(*prolcio.MCParticle)
+
+	referrers := eventIn.ReferrersOf(part1)
+	if len(referrers) != 4 {
+		t.Fatalf("Found %v referrers instead of 4", len(referrers))
+	}
+	if eventIn.collCache["TrackerHits"] == nil {
+		t.Error("Referring collection was not unpacked")
+	}
+	if eventIn.collCache["RawData"] != nil || eventIn.collCache["Tracks"] != nil {
+		t.Error("Collections not referring to the message were unpacked")
+	}
+	if eventIn.mayHoldReferences("RawData") || !eventIn.mayHoldReferences("Tracks") {
+		t.Error("Misjudged which collections may hold references")
+	}
+	if referrers[0].Collection != "MCParticles" || referrers[0].Field != "parents" {
+		t.Errorf("First referrer is %v.%v", referrers[0].Collection, referrers[0].Field)
+	}
+	for i, referrer := range referrers[1:] {
+		if referrer.Collection != "TrackerHits" || referrer.Field != "mc" {
+			t.Errorf("Referrer %v is %v.%v", i+1, referrer.Collection, referrer.Field)
+		}
+		if referrer.Entry != eventIn.Get("TrackerHits").GetEntry(uint32(i)) {
+			t.Errorf("Referrer %v has the wrong entry", i+1)
+		}
+	}
+
+	if referrers := eventIn.ReferrersOf(eventIn.Get("TrackerHits")); len(referrers) != 0 {
+		t.Errorf("Found %v referrers of an unreferenced collection", len(referrers))
+	}
+}
+
+func BenchmarkDereference(b *testing.B) {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	for i := 0; i < 10000; i++ {
+		MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: int32(i)})
+	}
+	refs := make([]*model.Reference, len(MCParticles.Entries))
+	for i, part := range MCParticles.Entries {
+		refs[i] = event.Reference(part)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event.Dereference(refs[i%len(refs)])
+	}
+}
+
+func BenchmarkPayloadCodec(b *testing.B) {
+	MCParticles := &prolcio.MCParticleCollection{}
+	for i := 0; i < 1000; i++ {
+		MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: int32(i), P: []float64{1, 2, 3}})
+	}
+	payload, err := MCParticles.Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, name := range []string{"gzip", "zstd", "lz4"} {
+		codec := GetCodec(name)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				compressed, err := compressPayload(payload, codec)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := decompressPayload(compressed, uint64(len(payload))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+type limitedWriter struct {
+	limit int
+}
+
+var errLimit = errors.New("write limit reached")
+
+func (wrt *limitedWriter) Write(buf []byte) (int, error) {
+	if len(buf) > wrt.limit {
+		n := wrt.limit
+		wrt.limit = 0
+		return n, errLimit
+	}
+	wrt.limit -= len(buf)
+	return len(buf), nil
+}
+
+func TestWriterErrors(t *testing.T) {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: 11})
+	event.Add(MCParticles, "MCParticles")
+
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	if err := writer.Push(event); err != nil {
+		t.Fatal(err)
+	}
+	eventSize := buffer.Len()
+	if writer.BytesWritten() != int64(eventSize) || writer.EventsWritten() != 1 {
+		t.Errorf("Writer counted %v bytes and %v events", writer.BytesWritten(), writer.EventsWritten())
+	}
+
+	writer = NewWriter(&limitedWriter{limit: eventSize + eventSize/2})
+	if err := writer.Push(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Push(event); err != errLimit {
+		t.Errorf("Push returned %v instead of write error", err)
+	}
+	if err := writer.Push(event); err != errLimit {
+		t.Errorf("Push after failure returned %v", err)
+	}
+	if err := writer.Close(); err != errLimit {
+		t.Errorf("Close after failure returned %v", err)
+	}
+	if writer.EventsWritten() != 1 || writer.BytesWritten() != int64(eventSize+eventSize/2) {
+		t.Errorf("Writer counted %v bytes and %v events", writer.BytesWritten(), writer.EventsWritten())
+	}
+}
+
+func TestGzipWriterFlush(t *testing.T) {
+	event := NewEvent()
+	event.Header.EventNumber = 42
+
+	buffer := &bytes.Buffer{}
+	writer := NewGzipWriter(buffer)
+	if err := writer.Push(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewGzipReader(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _ := reader.GetHeader()
+	if header == nil || header.EventNumber != 42 {
+		t.Error("Flushed event is not readable")
+	}
+}
+
+func TestScanEventsParallel(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	for i := 0; i < 50; i++ {
+		event := NewEvent()
+		event.Header.EventNumber = uint64(i)
+		MCParticles := &prolcio.MCParticleCollection{}
+		for j := 0; j < i%7; j++ {
+			MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{PDG: int32(i)})
+		}
+		event.Add(MCParticles, "MCParticles")
+		event.Add(&prolcio.SimTrackerHitCollection{}, "TrackerHits")
+		writer.Push(event)
+	}
+
+	reader := NewReader(buffer)
+	nEvents := 0
+	for event := range reader.ScanEventsParallel(4, "MCParticles") {
+		if event.Header.EventNumber != uint64(nEvents) {
+			t.Fatalf("Event %v arrived in position %v", event.Header.EventNumber, nEvents)
+		}
+		if _, ok := event.collCache["MCParticles"]; !ok {
+			t.Error("Selected collection was not decoded")
+		}
+		if _, ok := event.collCache["TrackerHits"]; ok {
+			t.Error("Unselected collection was decoded")
+		}
+		if n := event.Get("MCParticles").GetNEntries(); n != uint32(nEvents%7) {
+			t.Errorf("Event %v has %v entries", nEvents, n)
+		}
+		nEvents++
+	}
+	if nEvents != 50 {
+		t.Errorf("Scanned %v events instead of 50", nEvents)
+	}
+}
+
+func TestNext(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	for i := 0; i < 3; i++ {
+		event := NewEvent()
+		event.Header.EventNumber = uint64(i)
+		writer.Push(event)
+		buffer.Write([]byte{0xe1, 0x00})
+	}
+
+	reader := NewReader(buffer)
+	nEvents := 0
+	for reader.Next(context.Background()) {
+		if reader.Event().Header.EventNumber != uint64(nEvents) {
+			t.Errorf("Event %v arrived in position %v", reader.Event().Header.EventNumber, nEvents)
+		}
+		nEvents++
+	}
+	if nEvents != 3 {
+		t.Errorf("Read %v events instead of 3", nEvents)
+	}
+	if err := reader.Err(); err != ErrResync {
+		t.Errorf("Err() returned %v instead of ErrResync", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader = NewReader(&bytes.Buffer{})
+	if reader.Next(ctx) {
+		t.Error("Next() succeeded with a canceled context")
+	}
+	if err := reader.Err(); err != context.Canceled {
+		t.Errorf("Err() returned %v instead of context.Canceled", err)
+	}
+}
+
 type TruthRelation struct {
 	Truth *prolcio.MCParticle
 	PNorm []float64
@@ -256,7 +804,18 @@ func BenchmarkTracking(b *testing.B) {
 	}
 
 	b.ResetTimer()
-	tracking(reader, b)
+	tracking(reader.ScanEvents(), b)
+}
+
+func BenchmarkTrackingParallel(b *testing.B) {
+	filename := "../samples/largeSample.proio"
+	reader, err := Open(filename)
+	if err != nil {
+		b.Skip("Skipping tracking benchmark: missing input file ", filename)
+	}
+
+	b.ResetTimer()
+	tracking(reader.ScanEventsParallel(runtime.NumCPU(), "MCParticle", "Tracks"), b)
 }
 
 func BenchmarkTrackingGzip(b *testing.B) {
@@ -267,7 +826,7 @@ func BenchmarkTrackingGzip(b *testing.B) {
 	}
 
 	b.ResetTimer()
-	tracking(reader, b)
+	tracking(reader.ScanEvents(), b)
 }
 
 type TruthRelationLCIO struct {
@@ -300,9 +859,9 @@ func BenchmarkTrackingLCIO(b *testing.B) {
 	trackingLCIO(reader, b)
 }
 
-func tracking(reader *Reader, b *testing.B) {
+func tracking(events <-chan *Event, b *testing.B) {
 	b.N = 0
-	for event := range reader.ScanEvents() {
+	for event := range events {
 		b.N++
 
 		truthColl := event.Get("MCParticle").(*prolcio.MCParticleCollection)
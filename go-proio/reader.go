@@ -1,30 +1,78 @@
 package proio
 
 import (
-	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
+	"log"
 	"os"
-	"strings"
 	"sync"
 
 	"github.com/decibelcooper/proio/go-proio/model"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
 )
 
 type Reader struct {
-	Err                   chan error
-	EventScanBufferSize   int
+	// ScanErrs receives errors encountered by ScanEvents() and
+	// ScanEventsParallel().  Errors are dropped if the channel is full, so
+	// Next() or All() should be preferred when errors matter.
+	ScanErrs            chan error
+	EventScanBufferSize int
+
+	// If Logger is set, errors that are dropped because ScanErrs is full are
+	// logged to it, and events returned by the Reader inherit it (see
+	// Event.Logger).
+	Logger *log.Logger
+
+	// If ReadOnly is set, events returned by the Reader are ReadOnly (see
+	// Event.ReadOnly)
+	ReadOnly bool
+
+	// If Recover is set, the Reader salvages what it can from a damaged
+	// stream.  Whenever a record cannot be read, because its sizes are
+	// implausible, it is truncated, it fails its checksums, or it cannot be
+	// decoded, the stream is rewound to just after the record's magic number
+	// and searched for the next record that can be read.  Events are
+	// therefore decoded as they are read, even by ScanEventsParallel(), and
+	// ErrResync is returned along with the first event after any skipped
+	// bytes.  The stream must be seekable, or ErrNotSeekable is returned, and
+	// gzip streams must be written in blocks (see Writer.GzipBlockSize).
+	Recover bool
+
+	// If Recover is set, LostBytes is called with the start and end positions
+	// of each range of the stream that is skipped, if set.  Positions in
+	// seekable gzip streams are virtual offsets (see Writer.GzipBlockSize).
+	LostBytes func(start, end int64)
+
+	event      *Event
+	err        error
+	resynced   bool
+	recovering bool
+	streamEnd  int64
+
 	byteReader            io.Reader
 	deferredUntilClose    []func() error
 	deferredUntilStopScan []func()
 	getMutex              sync.Mutex
+	sizeBuf               [8 + checksumSize]byte
+	index                 *Index
+	descriptors           *descriptorPool
+	metadata              map[string][]byte
 }
 
 // Opens a file and adds the file as an io.Reader to a new Reader that is
-// returned.  If the file name ends with ".gz", the file is wrapped with
-// gzip.NewReader().  If the function returns successful (err == nil), the
-// Close() function should be called when finished.
+// returned.  If the file name ends with the suffix of a registered Codec (e.g.
+// ".gz", ".zst", ".lz4", ".xz" or ".bz2"), the file is decompressed with that
+// codec.  Otherwise, compression is detected by NewReader().  If the
+// decompressed stream is seekable (as uncompressed files and gzip files written
+// in blocks are, see Writer.GzipBlockSize) and a sidecar index file (see
+// IndexFilename()) exists and matches the size of the file, the index is
+// loaded for random access.  If the function returns successful (err == nil),
+// the Close() function should be called when finished.
 func Open(filename string) (*Reader, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -32,8 +80,8 @@ func Open(filename string) (*Reader, error) {
 	}
 
 	var reader *Reader
-	if strings.HasSuffix(filename, ".gz") {
-		reader, err = NewGzipReader(file)
+	if codec := codecForFilename(filename); codec != nil {
+		reader, err = NewCompressedReader(file, codec)
 		if err != nil {
 			file.Close()
 			return nil, err
@@ -42,10 +90,31 @@ func Open(filename string) (*Reader, error) {
 		reader = NewReader(file)
 	}
 	reader.deferUntilClose(file.Close)
+	if err := reader.loadIndexFile(filename); err != nil {
+		reader.Close()
+		return nil, err
+	}
 
 	return reader, nil
 }
 
+// Loads the sidecar index of a file if the stream is seekable and the index
+// matches it
+func (rdr *Reader) loadIndexFile(filename string) error {
+	seeker, ok := rdr.byteReader.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	idx, err := ReadIndexFile(IndexFilename(filename))
+	if err != nil {
+		return nil
+	}
+	if size, err := seeker.Seek(0, 2 /*io.SeekEnd*/); err == nil && size == idx.StreamSize {
+		rdr.index = idx
+	}
+	return rdr.seekToStart()
+}
+
 // Closes anything created by Open() or NewGzipReader()
 func (rdr *Reader) Close() error {
 	rdr.StopScan()
@@ -54,7 +123,7 @@ func (rdr *Reader) Close() error {
 			return err
 		}
 	}
-	close(rdr.Err)
+	close(rdr.ScanErrs)
 
 	return nil
 }
@@ -63,114 +132,472 @@ func (rdr *Reader) deferUntilClose(thisFunc func() error) {
 	rdr.deferredUntilClose = append(rdr.deferredUntilClose, thisFunc)
 }
 
-// Returns a new Reader for reading events from a stream
+// Returns a new Reader for reading events from a stream.  If the stream begins
+// with the magic bytes of a registered Codec, it is transparently decompressed,
+// and the Close() function should be called when finished.  Streams that
+// cannot seek are not read until the first read from the Reader.  Errors in
+// setting up decompression are returned by the first read from the Reader.
 func NewReader(byteReader io.Reader) *Reader {
+	codec, seekable, err := sniffSeekable(byteReader)
+	if err != nil {
+		return newReader(errReader{err})
+	}
+	if !seekable {
+		sniffer := &sniffingReader{byteReader: byteReader}
+		reader := newReader(sniffer)
+		reader.deferUntilClose(sniffer.Close)
+		return reader
+	}
+	if codec == nil {
+		return newReader(byteReader)
+	}
+
+	reader, err := NewCompressedReader(byteReader, codec)
+	if err != nil {
+		return newReader(errReader{err})
+	}
+	return reader
+}
+
+func newReader(byteReader io.Reader) *Reader {
 	return &Reader{
-		byteReader:          byteReader,
-		Err:                 make(chan error, 100),
+		byteReader:          newBufferedReader(byteReader),
+		ScanErrs:            make(chan error, 100),
 		EventScanBufferSize: 100,
 	}
 }
 
 // Opens a gzip stream and adds it as an io.Reader to a new Reader that is
-// returned.  The Close() function should be called before closing the stream.
+// returned.  If the stream implements io.Seeker and was written in blocks, the
+// Reader is seekable as well, with positions given as virtual offsets (see
+// Writer.GzipBlockSize).
+// The Close() function should be called before closing the stream.
 func NewGzipReader(byteReader io.Reader) (*Reader, error) {
-	gzReader, err := gzip.NewReader(byteReader)
+	gzReader, err := newGzipReader(byteReader)
 	if err != nil {
 		return nil, err
 	}
 
-	reader := NewReader(gzReader)
+	reader := newReader(gzReader)
 	reader.deferUntilClose(gzReader.Close)
 
 	return reader, nil
 }
 
-func (rdr *Reader) syncToMagic() (int, error) {
-	magicByteBuf := make([]byte, 1)
+func (rdr *Reader) syncToMagic() (int, byte, error) {
+	// Streams are always buffered by newReader()
+	byteReader := rdr.byteReader.(io.ByteReader)
 	nRead := 0
 	for {
-		err := readBytes(rdr.byteReader, magicByteBuf)
+		magicByte, err := byteReader.ReadByte()
 		if err != nil {
-			return nRead, err
+			return nRead, 0, err
 		}
 		nRead++
 
-		if magicByteBuf[0] == magicBytes[0] {
+		if magicByte == magicBytes[0] {
 			var goodSeq = true
-			for i := 1; i < 4; i++ {
-				err := readBytes(rdr.byteReader, magicByteBuf)
+			for i := 1; i < 3; i++ {
+				magicByte, err = byteReader.ReadByte()
 				if err != nil {
-					return nRead, err
+					return nRead, 0, err
 				}
 				nRead++
 
-				if magicByteBuf[0] != magicBytes[i] {
+				if magicByte != magicBytes[i] {
 					goodSeq = false
 					break
 				}
 			}
 
 			if goodSeq {
-				break
+				// The final byte of the magic number identifies the type of
+				// record that follows
+				magicByte, err = byteReader.ReadByte()
+				if err != nil {
+					return nRead, 0, err
+				}
+				nRead++
+
+				switch magicByte &^ checksumFlag {
+				case eventRecord, metadataRecord, compressedEventRecord, trailerRecord:
+					return nRead, magicByte, nil
+				}
+			}
+		}
+	}
+}
+
+// Synchronizes the stream to the start of the next event, processing any
+// metadata records and skipping any trailers found along the way.  The record type of the event is
+// returned, and the returned bool is true if bytes had to be skipped in order
+// to find the event.
+func (rdr *Reader) syncToEvent() (byte, bool, error) {
+	resynced := false
+	for {
+		n, recordType, err := rdr.syncToMagic()
+		if err != nil {
+			return 0, resynced, err
+		}
+		if n != len(magicBytes) {
+			resynced = true
+		}
+
+		switch recordType &^ checksumFlag {
+		case metadataRecord:
+			err = rdr.readMetadata(recordType)
+		case trailerRecord:
+			err = rdr.skipRecord(recordType)
+		default:
+			return recordType, resynced, nil
+		}
+		if err != nil {
+			return 0, resynced, err
+		}
+	}
+}
+
+// Passes over a record without reading its contents
+func (rdr *Reader) skipRecord(recordType byte) error {
+	headerSize, payloadSize, _, err := rdr.readFrameSizes(recordType)
+	if err != nil {
+		return err
+	}
+	size := int64(headerSize) + int64(payloadSize)
+	if seeker, ok := rdr.byteReader.(io.Seeker); ok {
+		err = seekBytes(seeker, size)
+	} else {
+		err = discardBytes(rdr.byteReader, size)
+	}
+	if err != nil {
+		return ErrTruncated
+	}
+	return nil
+}
+
+func (rdr *Reader) readMetadata(recordType byte) error {
+	keySize, valueSize, checksum, err := rdr.readFrameSizes(recordType)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, keySize+valueSize)
+	if err = readBytes(rdr.byteReader, buf); err != nil {
+		return ErrTruncated
+	}
+	key := string(buf[:keySize])
+	value := buf[keySize:]
+	if recordType&checksumFlag != 0 && frameChecksum(buf[:keySize], value) != checksum {
+		return ErrChecksum
+	}
+
+	switch key {
+	case descriptorsKey:
+		// A bad descriptor set only affects collections of unknown types, so
+		// it is not worth failing the read over
+		fileSet := &descriptor.FileDescriptorSet{}
+		if err := proto.Unmarshal(value, fileSet); err == nil {
+			if rdr.descriptors == nil {
+				rdr.descriptors = newDescriptorPool()
 			}
+			rdr.descriptors.addFileSet(fileSet)
+		}
+	default:
+		// Events that have already been read keep the previous map
+		metadata := make(map[string][]byte, len(rdr.metadata)+1)
+		for oldKey, oldValue := range rdr.metadata {
+			metadata[oldKey] = oldValue
+		}
+		metadata[key] = value
+		rdr.metadata = metadata
+	}
+
+	return nil
+}
+
+// Returns the metadata read from the stream so far (see
+// (*Writer) PushMetadata()), keyed by name.  The map is replaced rather than
+// updated as more metadata is read, and must not be modified.
+func (rdr *Reader) Metadata() map[string][]byte {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	return rdr.metadata
+}
+
+// Reads the sizes of a record.  If the record type has checksums, the sizes
+// are verified, and the checksum of the header and payload is returned as
+// well.
+func (rdr *Reader) readFrameSizes(recordType byte) (uint32, uint32, uint32, error) {
+	sizeBuf := rdr.sizeBuf[:8]
+	if recordType&checksumFlag != 0 {
+		sizeBuf = rdr.sizeBuf[:8+checksumSize]
+	}
+	if err := readBytes(rdr.byteReader, sizeBuf); err != nil {
+		return 0, 0, 0, ErrTruncated
+	}
+	headerSize := binary.LittleEndian.Uint32(sizeBuf[:4])
+	payloadSize := binary.LittleEndian.Uint32(sizeBuf[4:8])
+
+	checksum := uint32(0)
+	if recordType&checksumFlag != 0 {
+		if crc32.Checksum(sizeBuf[:8], crcTable) != binary.LittleEndian.Uint32(sizeBuf[8:]) {
+			return 0, 0, 0, ErrChecksum
 		}
+		checksum = binary.LittleEndian.Uint32(sizeBuf[12:])
+	}
+	if rdr.recovering && !rdr.plausibleSizes(headerSize, payloadSize) {
+		return 0, 0, 0, errImplausibleFrame
 	}
 
-	return nRead, nil
+	return headerSize, payloadSize, checksum, nil
 }
 
 var (
 	ErrResync    = errors.New("data stream had to be resynchronized")
 	ErrTruncated = errors.New("data stream is truncated early")
+	ErrChecksum  = errors.New("record does not match its checksum")
 )
 
 // Get() returns the next even upon success.  If the data stream is not aligned
 // with the beginning of an event, the stream will be resynchronized to the
-// next event, and ErrResync will be returned along with the event.
+// next event, and ErrResync will be returned along with the event.  If the
+// event was written with checksums (see Writer.Checksums) and does not match
+// them, ErrChecksum is returned without an event, and the following call
+// proceeds with the next event.  Likewise, events written in a newer major
+// version of the stream format are not returned, and ErrUnsupportedVersion is
+// returned in their place.
 func (rdr *Reader) Get() (*Event, error) {
 	rdr.getMutex.Lock()
 	defer rdr.getMutex.Unlock()
 
-	n, err := rdr.syncToMagic()
+	frame, resynced, err := rdr.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	event, err := frame.decode()
 	if err != nil {
 		return nil, err
 	}
 
-	headerSizeBuf := make([]byte, 4)
-	if err = readBytes(rdr.byteReader, headerSizeBuf); err != nil {
-		return nil, ErrTruncated
+	if resynced {
+		err = ErrResync
+	}
+
+	return event, err
+}
+
+// Next advances the Reader to the next event, which is then available from
+// Event().  It returns false at the end of the stream, when an error is
+// encountered, or when the context is canceled, after which Err() returns the
+// reason (nil at the end of the stream).  The context is checked between
+// events.  For example:
+//
+//	for reader.Next(ctx) {
+//		event := reader.Event()
+//		...
+//	}
+//	if err := reader.Err(); err != nil {
+//		...
+//	}
+//
+// Resynchronization of the stream does not stop iteration, but is reported
+// by Err() as ErrResync once no other error has occurred.
+func (rdr *Reader) Next(ctx context.Context) bool {
+	rdr.event = nil
+	if rdr.err != nil {
+		return false
+	}
+	if rdr.err = ctx.Err(); rdr.err != nil {
+		return false
+	}
+
+	event, err := rdr.Get()
+	switch err {
+	case nil:
+	case ErrResync:
+		rdr.resynced = true
+	case io.EOF:
+		return false
+	default:
+		rdr.err = err
+		return false
+	}
+
+	rdr.event = event
+	return true
+}
+
+// Returns the event found by the last call to Next()
+func (rdr *Reader) Event() *Event {
+	return rdr.event
+}
+
+// Returns the error that stopped Next(), or ErrResync if the stream had to be
+// resynchronized along the way
+func (rdr *Reader) Err() error {
+	if rdr.err == nil && rdr.resynced {
+		return ErrResync
+	}
+	return rdr.err
+}
+
+// rawFrame holds the undecoded bytes of an event read from the stream.  The
+// bytes are either in a buffer from framePool, or are shared with a mapped
+// file.
+type rawFrame struct {
+	header      []byte
+	payload     []byte
+	compressed  bool
+	shared      bool
+	descriptors *descriptorPool
+	metadata    map[string][]byte
+	logger      *log.Logger
+	readOnly    bool
+
+	// In recovery mode, frames are decoded as they are read
+	event *Event
+}
+
+func (rdr *Reader) readFrame() (*rawFrame, bool, error) {
+	if rdr.Recover {
+		return rdr.recoverFrame()
+	}
+
+	recordType, resynced, err := rdr.syncToEvent()
+	if err != nil {
+		return nil, resynced, err
+	}
+	frame, err := rdr.readFrameBody(recordType)
+	return frame, resynced, err
+}
+
+// Reads the remainder of an event record once its magic number has been read
+func (rdr *Reader) readFrameBody(recordType byte) (*rawFrame, error) {
+	headerSize, payloadSize, checksum, err := rdr.readFrameSizes(recordType)
+	if err != nil {
+		return nil, err
 	}
-	headerSize := binary.LittleEndian.Uint32(headerSizeBuf)
-	payloadSizeBuf := make([]byte, 4)
-	if err = readBytes(rdr.byteReader, payloadSizeBuf); err != nil {
+	checked := recordType&checksumFlag != 0
+
+	frame := &rawFrame{
+		compressed:  recordType&^checksumFlag == compressedEventRecord,
+		descriptors: rdr.descriptors,
+		metadata:    rdr.metadata,
+		logger:      rdr.Logger,
+		readOnly:    rdr.ReadOnly,
+	}
+
+	// The sizes are verified against the checksums at the start of the
+	// header, if any, before the rest of the record is read
+	headerStartSize := headerChecksumSize
+	if int(headerSize) < headerStartSize {
+		headerStartSize = int(headerSize)
+	}
+
+	if mapped, ok := rdr.byteReader.(*mappedReader); ok {
+		if err = checkSizesChecksum(mapped.peek(headerStartSize), headerSize, payloadSize); err != nil {
+			return nil, err
+		}
+		frame.shared = true
+		if frame.header, err = mapped.next(int(headerSize)); err != nil {
+			return nil, err
+		}
+		if frame.payload, err = mapped.next(int(payloadSize)); err != nil {
+			return nil, err
+		}
+		if checked && frameChecksum(frame.header, frame.payload) != checksum {
+			return nil, ErrChecksum
+		}
+		if frame.header, err = checkHeaderChecksum(frame.header, frame.payload); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	// Nothing is allocated for the record until its sizes are verified
+	var headerStartBuf [headerChecksumSize]byte
+	headerStart := headerStartBuf[:headerStartSize]
+	if err = readBytes(rdr.byteReader, headerStart); err != nil {
 		return nil, ErrTruncated
 	}
-	payloadSize := binary.LittleEndian.Uint32(payloadSizeBuf)
+	if err = checkSizesChecksum(headerStart, headerSize, payloadSize); err != nil {
+		return nil, err
+	}
 
-	headerBuf := make([]byte, headerSize)
-	if err = readBytes(rdr.byteReader, headerBuf); err != nil {
+	// The payload is placed first so that the buffer keeps its full
+	// capacity when it is released
+	buf := getFrameBuffer(int(payloadSize) + int(headerSize))
+	frame.payload = buf[:payloadSize]
+	frame.header = buf[payloadSize:]
+	copy(frame.header, headerStart)
+	if err = readBytes(rdr.byteReader, frame.header[len(headerStart):]); err != nil {
+		putFrameBuffer(buf)
 		return nil, ErrTruncated
 	}
-	header := &model.EventHeader{}
-	if err = header.Unmarshal(headerBuf); err != nil {
+	if err = readBytes(rdr.byteReader, frame.payload); err != nil {
+		putFrameBuffer(buf)
 		return nil, ErrTruncated
 	}
+	if checked && frameChecksum(frame.header, frame.payload) != checksum {
+		putFrameBuffer(buf)
+		return nil, ErrChecksum
+	}
+	if frame.header, err = checkHeaderChecksum(frame.header, frame.payload); err != nil {
+		putFrameBuffer(buf)
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// Returns the frame's buffer to framePool, once the frame will not be decoded
+func (frame *rawFrame) release() {
+	if !frame.shared {
+		putFrameBuffer(frame.payload)
+	}
+}
+
+func (frame *rawFrame) decode() (*Event, error) {
+	if frame.event != nil {
+		return frame.event, nil
+	}
 
-	payload := make([]byte, payloadSize)
-	if err = readBytes(rdr.byteReader, payload); err != nil {
+	header := &model.EventHeader{}
+	if err := header.Unmarshal(frame.header); err != nil {
+		frame.release()
 		return nil, ErrTruncated
 	}
+	if err := checkVersion(header); err != nil {
+		frame.release()
+		return nil, err
+	}
+
+	payload := frame.payload
+	shared := frame.shared
+	if frame.compressed {
+		size := uint64(0)
+		for _, collHdr := range header.PayloadCollections {
+			size += uint64(collHdr.PayloadSize)
+		}
+		var err error
+		payload, err = decompressPayload(payload, size)
+		frame.release()
+		if err != nil {
+			return nil, err
+		}
+		shared = false
+	}
 
 	event := NewEvent()
 	event.Header = header
 	event.setPayload(payload)
+	event.sharedPayload = shared
+	event.descriptors = frame.descriptors
+	event.Metadata = frame.metadata
+	event.Logger = frame.logger
+	event.ReadOnly = frame.readOnly
 
-	if n != 4 {
-		err = ErrResync
-	}
-
-	return event, err
+	return event, nil
 }
 
 //ScanEvents returns a buffered channel of type Event where all of the events
@@ -178,7 +605,7 @@ func (rdr *Reader) Get() (*Event, error) {
 //Reader.EventScanBufferSize which defaults to 100.  The goroutine responsible
 //for fetching events will not break until there are no more events,
 //Reader.StopScan() is called, or Reader.Close() is called.  In this scenario,
-//errors are pushed to the Reader.Err channel.
+//errors are pushed to the Reader.ScanErrs channel.
 func (rdr *Reader) ScanEvents() <-chan *Event {
 	events := make(chan *Event, rdr.EventScanBufferSize)
 	quit := make(chan int)
@@ -188,10 +615,7 @@ func (rdr *Reader) ScanEvents() <-chan *Event {
 		for {
 			event, err := rdr.Get()
 			if err != nil {
-				select {
-				case rdr.Err <- err:
-				default:
-				}
+				rdr.pushScanErr(err)
 			}
 			if event == nil {
 				return
@@ -214,6 +638,119 @@ func (rdr *Reader) ScanEvents() <-chan *Event {
 	return events
 }
 
+// ScanEventsParallel is like ScanEvents(), except that only the reading of
+// raw event frames is done by the scanning goroutine.  Decoding of the event
+// headers, as well as of the named collections, is fanned out to a pool of
+// worker goroutines.  Events are delivered in their original order, with the
+// named collections already deserialized so that (*Event) Get() returns
+// immediately.  The scan is stopped by Reader.StopScan() or Reader.Close(), and
+// errors are pushed to the Reader.ScanErrs channel.
+func (rdr *Reader) ScanEventsParallel(workers int, collections ...string) <-chan *Event {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		frame  *rawFrame
+		result chan *Event
+	}
+
+	events := make(chan *Event, rdr.EventScanBufferSize)
+	ordered := make(chan *job, rdr.EventScanBufferSize)
+	jobs := make(chan *job, workers)
+	quit := make(chan int)
+
+	pushErr := rdr.pushScanErr
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for {
+			rdr.getMutex.Lock()
+			frame, resynced, err := rdr.readFrame()
+			rdr.getMutex.Unlock()
+			if err != nil {
+				pushErr(err)
+			} else if resynced {
+				pushErr(ErrResync)
+			}
+			if frame == nil {
+				return
+			}
+
+			thisJob := &job{
+				frame:  frame,
+				result: make(chan *Event, 1),
+			}
+			select {
+			case ordered <- thisJob:
+			case <-quit:
+				return
+			}
+			select {
+			case jobs <- thisJob:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for thisJob := range jobs {
+				event, err := thisJob.frame.decode()
+				if err != nil {
+					pushErr(err)
+				} else {
+					for _, name := range collections {
+						event.Get(name)
+					}
+				}
+				thisJob.result <- event
+			}
+		}()
+	}
+
+	go func() {
+		defer close(events)
+		for thisJob := range ordered {
+			var event *Event
+			select {
+			case event = <-thisJob.result:
+			case <-quit:
+				return
+			}
+			if event == nil {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	rdr.deferUntilStopScan(
+		func() {
+			close(quit)
+		},
+	)
+
+	return events
+}
+
+func (rdr *Reader) pushScanErr(err error) {
+	select {
+	case rdr.ScanErrs <- err:
+	default:
+		if rdr.Logger != nil {
+			rdr.Logger.Print("dropped scan error: ", err)
+		}
+	}
+}
+
 func (rdr *Reader) deferUntilStopScan(thisFunc func()) {
 	rdr.deferredUntilStopScan = append(rdr.deferredUntilStopScan, thisFunc)
 }
@@ -233,21 +770,15 @@ func (rdr *Reader) GetHeader() (*model.EventHeader, error) {
 	rdr.getMutex.Lock()
 	defer rdr.getMutex.Unlock()
 
-	n, err := rdr.syncToMagic()
+	recordType, resynced, err := rdr.syncToEvent()
 	if err != nil {
 		return nil, err
 	}
 
-	headerSizeBuf := make([]byte, 4)
-	if err = readBytes(rdr.byteReader, headerSizeBuf); err != nil {
-		return nil, ErrTruncated
-	}
-	headerSize := binary.LittleEndian.Uint32(headerSizeBuf)
-	payloadSizeBuf := make([]byte, 4)
-	if err = readBytes(rdr.byteReader, payloadSizeBuf); err != nil {
-		return nil, ErrTruncated
+	headerSize, payloadSize, _, err := rdr.readFrameSizes(recordType)
+	if err != nil {
+		return nil, err
 	}
-	payloadSize := binary.LittleEndian.Uint32(payloadSizeBuf)
 
 	headerBuf := make([]byte, headerSize)
 	if err = readBytes(rdr.byteReader, headerBuf); err != nil {
@@ -263,17 +794,15 @@ func (rdr *Reader) GetHeader() (*model.EventHeader, error) {
 		if err = seekBytes(seeker, int64(payloadSize)); err != nil {
 			return header, ErrTruncated
 		}
-	} else {
-		payload := make([]byte, payloadSize)
-		if err = readBytes(rdr.byteReader, payload); err != nil {
-			return header, ErrTruncated
-		}
+	} else if err = discardBytes(rdr.byteReader, int64(payloadSize)); err != nil {
+		return header, ErrTruncated
 	}
 
-	if n != 4 {
+	if err = checkVersion(header); err != nil {
+		return nil, err
+	}
+	if resynced {
 		err = ErrResync
-	} else {
-		err = nil
 	}
 
 	return header, err
@@ -289,35 +818,25 @@ func (rdr *Reader) Skip(nEvents int) (int, error) {
 
 	nSkipped := 0
 	for i := 0; i < nEvents; i++ {
-		n, err := rdr.syncToMagic()
+		recordType, resynced, err := rdr.syncToEvent()
 		if err != nil {
 			return nSkipped, err
 		}
-		if n != 4 {
+		if resynced {
 			wasResynced = true
 		}
 
-		headerSizeBuf := make([]byte, 4)
-		if err = readBytes(rdr.byteReader, headerSizeBuf); err != nil {
-			return nSkipped, ErrTruncated
-		}
-		headerSize := binary.LittleEndian.Uint32(headerSizeBuf)
-
-		payloadSizeBuf := make([]byte, 4)
-		if err = readBytes(rdr.byteReader, payloadSizeBuf); err != nil {
-			return nSkipped, ErrTruncated
+		headerSize, payloadSize, _, err := rdr.readFrameSizes(recordType)
+		if err != nil {
+			return nSkipped, err
 		}
-		payloadSize := binary.LittleEndian.Uint32(payloadSizeBuf)
 
 		if isSeeker {
 			if err = seekBytes(seeker, int64(headerSize+payloadSize)); err != nil {
 				return nSkipped, ErrTruncated
 			}
-		} else {
-			headerBuf := make([]byte, headerSize+payloadSize)
-			if err = readBytes(rdr.byteReader, headerBuf); err != nil {
-				return nSkipped, ErrTruncated
-			}
+		} else if err = discardBytes(rdr.byteReader, int64(headerSize)+int64(payloadSize)); err != nil {
+			return nSkipped, ErrTruncated
 		}
 
 		nSkipped++
@@ -334,11 +853,15 @@ func (rdr *Reader) Skip(nEvents int) (int, error) {
 var ErrNotSeekable = errors.New("data stream is not seekable")
 
 // If the stream implements io.Seeker (typically a file), reset back to the
-// beginning of the file.
+// beginning of the file.  Metadata read so far is forgotten.
 func (rdr *Reader) SeekToStart() error {
 	rdr.getMutex.Lock()
 	defer rdr.getMutex.Unlock()
 
+	return rdr.seekToStart()
+}
+
+func (rdr *Reader) seekToStart() error {
 	seeker, ok := rdr.byteReader.(io.Seeker)
 	if !ok {
 		return ErrNotSeekable
@@ -353,6 +876,7 @@ func (rdr *Reader) SeekToStart() error {
 			break
 		}
 	}
+	rdr.metadata = nil
 
 	return nil
 }
@@ -369,7 +893,19 @@ func readBytes(rdr io.Reader, buf []byte) error {
 	return nil
 }
 
+func discardBytes(rdr io.Reader, nBytes int64) error {
+	n, err := io.CopyN(ioutil.Discard, rdr, nBytes)
+	if n == nBytes {
+		return nil
+	}
+	return err
+}
+
 func seekBytes(seeker io.Seeker, nBytes int64) error {
+	if gzReader, ok := seeker.(*blockGzipReader); ok {
+		return gzReader.skipBytes(nBytes)
+	}
+
 	start, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
 	if err != nil {
 		return err
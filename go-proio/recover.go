@@ -0,0 +1,165 @@
+package proio
+
+import (
+	"errors"
+	"io"
+)
+
+// Limits on the sizes of records found in recovery mode, beyond which sizes
+// are assumed to be corrupted
+const (
+	maxRecoverHeaderSize  = 1 << 24
+	maxRecoverPayloadSize = 1 << 30
+)
+
+var errImplausibleFrame = errors.New("record sizes are implausible")
+
+// Reads the next event record that can be decoded, searching past any records
+// that cannot be read
+func (rdr *Reader) recoverFrame() (*rawFrame, bool, error) {
+	seeker, ok := rdr.byteReader.(io.Seeker)
+	if !ok {
+		return nil, false, ErrNotSeekable
+	}
+	if rdr.streamEnd == 0 {
+		if err := rdr.findStreamEnd(seeker); err != nil {
+			return nil, false, err
+		}
+	}
+	rdr.recovering = true
+	defer func() {
+		rdr.recovering = false
+	}()
+
+	resynced := false
+	lostStart := int64(-1)
+	reportLost := func(end int64) {
+		if lostStart >= 0 && end > lostStart && rdr.LostBytes != nil {
+			rdr.LostBytes(lostStart, end)
+		}
+		lostStart = -1
+	}
+
+	for {
+		start, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+		if err != nil {
+			return nil, resynced, err
+		}
+		n, recordType, err := rdr.syncToMagic()
+		if err != nil {
+			if err == io.EOF {
+				if n > 0 && lostStart < 0 {
+					lostStart = start
+				}
+				end, _ := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+				reportLost(end)
+			}
+			return nil, resynced, err
+		}
+		magicEnd, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+		if err != nil {
+			return nil, resynced, err
+		}
+		magicStart := magicEnd - int64(len(magicBytes))
+		if n != len(magicBytes) {
+			resynced = true
+			if lostStart < 0 {
+				lostStart = start
+			}
+		}
+
+		var frame *rawFrame
+		switch recordType &^ checksumFlag {
+		case metadataRecord:
+			err = rdr.readMetadata(recordType)
+		case trailerRecord:
+			err = rdr.skipRecord(recordType)
+		default:
+			if frame, err = rdr.readFrameBody(recordType); err == nil {
+				frame.event, err = frame.decodeChecked()
+			}
+		}
+		if err == nil {
+			reportLost(magicStart)
+			if frame != nil {
+				return frame, resynced, nil
+			}
+			continue
+		}
+		if err == ErrUnsupportedVersion {
+			reportLost(magicStart)
+			return nil, resynced, err
+		}
+
+		resynced = true
+		if lostStart < 0 {
+			lostStart = magicStart
+		}
+		if _, err := seeker.Seek(magicEnd, 0 /*io.SeekStart*/); err != nil {
+			return nil, resynced, err
+		}
+	}
+}
+
+// Decodes the frame, and checks that the collections of the event account for
+// its whole payload and can each be decoded
+func (frame *rawFrame) decodeChecked() (*Event, error) {
+	event, err := frame.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	payloadSize := uint64(0)
+	for _, collHdr := range event.Header.PayloadCollections {
+		payloadSize += uint64(collHdr.PayloadSize)
+	}
+	if payloadSize != uint64(len(event.payload)) {
+		event.Release()
+		return nil, ErrPayloadSize
+	}
+
+	for _, collHdr := range event.Header.PayloadCollections {
+		_, err := event.peek(collHdr.Name)
+		if err == ErrUnknownType && event.GetDynamic(collHdr.Name) != nil {
+			// Collections of unknown types can only be checked for
+			// corruption in the wire format
+			err = nil
+		}
+		if err != nil {
+			event.Release()
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// Finds the size of the stream, for checking the sizes of records against.
+// The sizes of gzip streams are unknown.
+func (rdr *Reader) findStreamEnd(seeker io.Seeker) error {
+	if _, ok := seeker.(*blockGzipReader); ok {
+		rdr.streamEnd = -1
+		return nil
+	}
+
+	pos, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+	if err != nil {
+		return err
+	}
+	if rdr.streamEnd, err = seeker.Seek(0, 2 /*io.SeekEnd*/); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(pos, 0 /*io.SeekStart*/)
+	return err
+}
+
+func (rdr *Reader) plausibleSizes(headerSize, payloadSize uint32) bool {
+	if headerSize > maxRecoverHeaderSize || payloadSize > maxRecoverPayloadSize {
+		return false
+	}
+	if rdr.streamEnd < 0 {
+		return true
+	}
+
+	pos, err := rdr.byteReader.(io.Seeker).Seek(0, 1 /*io.SeekCurrent*/)
+	return err == nil && pos+int64(headerSize)+int64(payloadSize) <= rdr.streamEnd
+}
@@ -0,0 +1,125 @@
+package proio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+type lostRange struct {
+	start, end int64
+}
+
+// Reads all events in recovery mode, returning their event numbers and the
+// byte ranges lost
+func recoverEvents(t *testing.T, stream []byte) ([]uint64, []lostRange) {
+	reader := NewReader(bytes.NewReader(stream))
+	reader.Recover = true
+	var lost []lostRange
+	reader.LostBytes = func(start, end int64) {
+		lost = append(lost, lostRange{start, end})
+	}
+
+	var numbers []uint64
+	for {
+		event, err := reader.Get()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != ErrResync {
+			t.Fatal(err)
+		}
+		numbers = append(numbers, event.Header.EventNumber)
+	}
+	return numbers, lost
+}
+
+func TestRecover(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), 4, nil)
+	stream := buffer.Bytes()
+	idx, err := NewReader(bytes.NewReader(stream)).Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := make([]int64, 0, 5)
+	for _, entry := range idx.Entries {
+		offsets = append(offsets, entry.Offset)
+	}
+	offsets = append(offsets, int64(len(stream)))
+
+	// A corrupted header size stops an ordinary Reader
+	corrupt := append([]byte(nil), stream...)
+	corrupt[offsets[1]+int64(len(magicBytes))+2] = 0x01
+	reader := NewReader(bytes.NewReader(corrupt))
+	reader.Get()
+	if _, err := reader.Get(); err != ErrTruncated {
+		t.Errorf("Corrupted header size returned %v", err)
+	}
+	numbers, lost := recoverEvents(t, corrupt)
+	if !reflect.DeepEqual(numbers, []uint64{0, 2, 3}) {
+		t.Errorf("Recovered events %v from corrupted size", numbers)
+	}
+	if !reflect.DeepEqual(lost, []lostRange{{offsets[1], offsets[2]}}) {
+		t.Errorf("Lost %v from corrupted size", lost)
+	}
+
+	// Garbage containing a false magic number, with plausible sizes
+	garbage := append(append([]byte{1, 2}, magicBytes[:]...), 2, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 3)
+	corrupt = append(append(append([]byte(nil), stream[:offsets[2]]...), garbage...), stream[offsets[2]:]...)
+	numbers, lost = recoverEvents(t, corrupt)
+	if !reflect.DeepEqual(numbers, []uint64{0, 1, 2, 3}) {
+		t.Errorf("Recovered events %v around garbage", numbers)
+	}
+	if !reflect.DeepEqual(lost, []lostRange{{offsets[2], offsets[2] + int64(len(garbage))}}) {
+		t.Errorf("Lost %v around garbage", lost)
+	}
+
+	// Truncated final event
+	numbers, lost = recoverEvents(t, stream[:offsets[4]-1])
+	if !reflect.DeepEqual(numbers, []uint64{0, 1, 2}) {
+		t.Errorf("Recovered events %v from truncated stream", numbers)
+	}
+	if !reflect.DeepEqual(lost, []lostRange{{offsets[3], offsets[4] - 1}}) {
+		t.Errorf("Lost %v from truncated stream", lost)
+	}
+
+	// Collections that cannot be decoded, with sizes that add up
+	buffer.Reset()
+	writer := NewWriter(buffer)
+	for i := 0; i < 3; i++ {
+		event := NewEvent()
+		event.Header.EventNumber = uint64(i)
+		event.Header.PayloadCollections = []*model.EventHeader_CollectionHeader{
+			{Name: "Unknown", Type: "unknown.Collection", PayloadSize: 2},
+		}
+		payload := []byte{0x08, 0x01}
+		if i == 1 {
+			event.Header.PayloadCollections = append(event.Header.PayloadCollections,
+				&model.EventHeader_CollectionHeader{Name: "Corrupt", Type: "lcio.MCParticleCollection", PayloadSize: 2})
+			payload = append(payload, 0xff, 0xff)
+		}
+		event.setPayload(payload)
+		if err := writer.Push(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	numbers, lost = recoverEvents(t, buffer.Bytes())
+	if !reflect.DeepEqual(numbers, []uint64{0, 2}) {
+		t.Errorf("Recovered events %v around corrupt collection", numbers)
+	}
+	if len(lost) != 1 {
+		t.Errorf("Lost %v around corrupt collection", lost)
+	}
+
+	reader = NewReader(ioutil.NopCloser(bytes.NewReader(stream)))
+	reader.Recover = true
+	if _, err := reader.Get(); err != ErrNotSeekable {
+		t.Errorf("Recovering from an unseekable stream returned %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package proio
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// Referrer identifies a Reference held by an entry of a collection.  Field is
+// the name of the field holding the Reference, as given in the protobuf
+// definition, with the names of any enclosing fields prepended and separated
+// by dots.
+type Referrer struct {
+	Collection string
+	Entry      Message
+	Field      string
+}
+
+// Returns the entries in the event that hold a Reference to the given message,
+// which may be a collection or an entry within a collection, as for
+// (*Event) Reference().  This inverts references that the data model stores
+// in one direction only, e.g. to find the hits of an MCParticle.  Every
+// collection whose type may hold References is decoded and scanned, so when
+// looking up many messages it is cheaper to invert the references in one pass
+// by hand.  Only the collections found to refer to the message are unpacked
+// into the event.  Nil is returned if the message is not in the event or has
+// never been referenced.
+func (evt *Event) ReferrersOf(msg Message) []Referrer {
+	coll := evt.collectionOf(msg)
+	if coll == nil {
+		return nil
+	}
+	target := refKey{collID: coll.GetId()}
+	if msg != coll {
+		target.entryID = msg.GetId()
+		if target.entryID == 0 {
+			return nil
+		}
+	}
+	if target.collID == 0 {
+		return nil
+	}
+
+	names := evt.GetNames()
+	sort.Strings(names)
+
+	var referrers []Referrer
+	for _, name := range names {
+		if !evt.mayHoldReferences(name) {
+			continue
+		}
+		refColl, err := evt.peek(name)
+		if err == ErrUnknownType {
+			// Snapshots of collections of unknown types can still be
+			// searched
+			if dynColl := evt.GetDynamic(name); dynColl != nil {
+				refColl = dynColl
+			}
+		}
+		if refColl == nil {
+			continue
+		}
+
+		var entries []uint32
+		var fields []string
+		for i := uint32(0); i < refColl.GetNEntries(); i++ {
+			entry, ok := refColl.GetEntry(i).(Message)
+			if !ok {
+				continue
+			}
+			visitReferences(entry, "", func(field string, key refKey, _ func(refKey)) bool {
+				if key == target {
+					entries = append(entries, i)
+					fields = append(fields, field)
+				}
+				return true
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		// The referrers are returned from the event rather than from a
+		// snapshot
+		if _, isDynamic := refColl.(*DynamicMessage); !isDynamic {
+			if refColl, err = evt.GetE(name); err != nil {
+				continue
+			}
+		}
+		for i, entryIndex := range entries {
+			referrers = append(referrers, Referrer{
+				Collection: name,
+				Entry:      refColl.GetEntry(entryIndex).(Message),
+				Field:      fields[i],
+			})
+		}
+	}
+
+	return referrers
+}
+
+var referenceType = reflect.TypeOf(&model.Reference{})
+
+// Reports whether a collection may hold References, judging by the descriptor
+// of its type.  Collections of types without descriptors may hold anything.
+func (evt *Event) mayHoldReferences(name string) bool {
+	var collType string
+	if coll := evt.collCache[name]; coll != nil {
+		collType = GetType(coll)
+	} else if coll := evt.viewCache[name]; coll != nil {
+		collType = GetType(coll)
+	} else {
+		for _, collHdr := range evt.Header.PayloadCollections {
+			if collHdr.Name == name {
+				collType = collHdr.Type
+				break
+			}
+		}
+	}
+
+	dynType := lookupDynamicType("proio.model."+collType, evt.descriptors)
+	return typeHoldsReferences(dynType, make(map[string]bool))
+}
+
+func typeHoldsReferences(dynType *dynamicType, seen map[string]bool) bool {
+	if dynType.pool == nil {
+		// The type has no schema
+		return true
+	}
+	seen[dynType.name] = true
+
+	for _, fieldDesc := range dynType.desc.Field {
+		if fieldDesc.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+			continue
+		}
+		typeName := strings.TrimPrefix(fieldDesc.GetTypeName(), ".")
+		if typeName == "proio.model.Reference" {
+			return true
+		}
+		if seen[typeName] {
+			continue
+		}
+		fieldType := dynType.pool.getType(typeName)
+		if fieldType == nil || typeHoldsReferences(fieldType, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls visit for every Reference held by a message or by messages nested
+// within it.  The Reference may be changed by calling update, and is removed
+// from the message if visit returns false.
+func visitReferences(msg Message, prefix string, visit func(field string, key refKey, update func(refKey)) bool) {
+	if dynMsg, ok := msg.(*DynamicMessage); ok {
+		visitDynamicReferences(dynMsg, prefix, visit)
+		return
+	}
+	visitValueReferences(reflect.ValueOf(msg), prefix, visit)
+}
+
+// Visits the References within a value, returning false if the value is
+// itself a Reference that should be removed
+func visitValueReferences(value reflect.Value, field string, visit func(string, refKey, func(refKey)) bool) bool {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return true
+		}
+		if value.Type() == referenceType {
+			ref := value.Interface().(*model.Reference)
+			return visit(field, refKey{ref.CollID, ref.EntryID}, func(key refKey) {
+				ref.CollID = key.collID
+				ref.EntryID = key.entryID
+			})
+		}
+		value = value.Elem()
+		if value.Kind() != reflect.Struct {
+			return true
+		}
+
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			structField := valueType.Field(i)
+			name := protoFieldName(structField)
+			if name == "" {
+				continue
+			}
+			if field != "" {
+				name = field + "." + name
+			}
+			if !visitValueReferences(value.Field(i), name, visit) {
+				value.Field(i).Set(reflect.Zero(structField.Type))
+			}
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.Ptr {
+			return true
+		}
+		n := 0
+		for i := 0; i < value.Len(); i++ {
+			if visitValueReferences(value.Index(i), field, visit) {
+				value.Index(n).Set(value.Index(i))
+				n++
+			}
+		}
+		if n < value.Len() {
+			value.SetLen(n)
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.Ptr {
+			return true
+		}
+		for _, key := range value.MapKeys() {
+			if !visitValueReferences(value.MapIndex(key), field, visit) {
+				value.SetMapIndex(key, reflect.Value{})
+			}
+		}
+	}
+	return true
+}
+
+// Returns the field name from the protobuf struct tag, or an empty string for
+// fields that are not protobuf fields
+func protoFieldName(structField reflect.StructField) string {
+	for _, option := range strings.Split(structField.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(option, "name=") {
+			return strings.TrimPrefix(option, "name=")
+		}
+	}
+	return ""
+}
+
+func visitDynamicReferences(msg *DynamicMessage, field string, visit func(string, refKey, func(refKey)) bool) bool {
+	if msg.dynType.name == "proio.model.Reference" {
+		var key refKey
+		for _, wireField := range msg.fields {
+			switch wireField.number {
+			case 1:
+				key.collID = uint32(wireField.scalar)
+			case 2:
+				key.entryID = uint32(wireField.scalar)
+			}
+		}
+		return visit(field, key, func(key refKey) {
+			msg.fields = nil
+			if key.collID != 0 {
+				msg.fields = append(msg.fields, &dynamicField{number: 1, wireType: wireVarint, scalar: uint64(key.collID)})
+			}
+			if key.entryID != 0 {
+				msg.fields = append(msg.fields, &dynamicField{number: 2, wireType: wireVarint, scalar: uint64(key.entryID)})
+			}
+		})
+	}
+
+	fields := msg.fields[:0]
+	for _, wireField := range msg.fields {
+		if wireField.msg != nil {
+			name := msg.dynType.fields[wireField.number].GetName()
+			if field != "" {
+				name = field + "." + name
+			}
+			if !visitDynamicReferences(wireField.msg, name, visit) {
+				continue
+			}
+		}
+		fields = append(fields, wireField)
+	}
+	msg.fields = fields
+	return true
+}
@@ -0,0 +1,304 @@
+package proio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+// Summary holds statistics of the events of a stream, as recorded in its
+// trailer (see Writer.Trailer)
+type Summary struct {
+	NEvents int64
+
+	// Runs lists the distinct run numbers of the events, in order of first
+	// appearance
+	Runs []uint64
+
+	// TypeBytes holds the total uncompressed payload bytes of the collections
+	// of each type, keyed by type name
+	TypeBytes map[string]uint64
+}
+
+var (
+	ErrNoTrailer  = errors.New("stream has no trailer")
+	ErrBadTrailer = errors.New("trailer is invalid or corrupted")
+)
+
+// A trailer record holds a serialized Summary as its header and a serialized
+// Index as its payload.  The payload ends with a footer, which is the offset
+// of the trailer record in the stream followed by the trailer magic number, so
+// that the trailer can be found from the end of a file.
+var trailerMagicBytes = [...]byte{
+	byte('P'),
+	byte('T'),
+	byte('R'),
+	byte('L'),
+}
+
+const trailerFooterSize = 12
+
+// Serialize the summary.  The format is the number of events, followed by the
+// number of runs and the run numbers, followed by the number of collection
+// types and, for each type in order of name, the size of the name, the name
+// and the number of bytes, all little-endian.
+func (summary *Summary) marshal() []byte {
+	types := make([]string, 0, len(summary.TypeBytes))
+	size := 24 + 8*len(summary.Runs)
+	for collType := range summary.TypeBytes {
+		types = append(types, collType)
+		size += 12 + len(collType)
+	}
+	sort.Strings(types)
+
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint64(buf, uint64(summary.NEvents))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(len(summary.Runs)))
+	pos := 16
+	for _, run := range summary.Runs {
+		binary.LittleEndian.PutUint64(buf[pos:], run)
+		pos += 8
+	}
+	binary.LittleEndian.PutUint64(buf[pos:], uint64(len(types)))
+	pos += 8
+	for _, collType := range types {
+		binary.LittleEndian.PutUint32(buf[pos:], uint32(len(collType)))
+		pos += 4
+		pos += copy(buf[pos:], collType)
+		binary.LittleEndian.PutUint64(buf[pos:], summary.TypeBytes[collType])
+		pos += 8
+	}
+	return buf
+}
+
+func unmarshalSummary(buf []byte) (*Summary, error) {
+	next := func(n int) []byte {
+		if n < 0 || n > len(buf) {
+			return nil
+		}
+		field := buf[:n]
+		buf = buf[n:]
+		return field
+	}
+	nextUint64 := func() (uint64, bool) {
+		field := next(8)
+		if field == nil {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint64(field), true
+	}
+
+	summary := &Summary{TypeBytes: make(map[string]uint64)}
+	nEvents, ok := nextUint64()
+	if !ok {
+		return nil, ErrBadTrailer
+	}
+	summary.NEvents = int64(nEvents)
+
+	nRuns, ok := nextUint64()
+	if !ok || nRuns > uint64(len(buf)/8) {
+		return nil, ErrBadTrailer
+	}
+	summary.Runs = make([]uint64, nRuns)
+	for i := range summary.Runs {
+		summary.Runs[i], _ = nextUint64()
+	}
+
+	nTypes, ok := nextUint64()
+	if !ok {
+		return nil, ErrBadTrailer
+	}
+	for i := uint64(0); i < nTypes; i++ {
+		nameSize := next(4)
+		if nameSize == nil {
+			return nil, ErrBadTrailer
+		}
+		name := next(int(binary.LittleEndian.Uint32(nameSize)))
+		if name == nil {
+			return nil, ErrBadTrailer
+		}
+		if summary.TypeBytes[string(name)], ok = nextUint64(); !ok {
+			return nil, ErrBadTrailer
+		}
+	}
+
+	return summary, nil
+}
+
+// trailerBuilder accumulates the contents of a trailer as records are written
+type trailerBuilder struct {
+	summary Summary
+	index   Index
+	runs    map[uint64]bool
+}
+
+func newTrailerBuilder() *trailerBuilder {
+	return &trailerBuilder{
+		summary: Summary{TypeBytes: make(map[string]uint64)},
+		runs:    make(map[uint64]bool),
+	}
+}
+
+func (trailer *trailerBuilder) addEvent(offset int64, header *model.EventHeader, headerSize, payloadSize int) {
+	trailer.summary.NEvents++
+	if !trailer.runs[header.RunNumber] {
+		trailer.runs[header.RunNumber] = true
+		trailer.summary.Runs = append(trailer.summary.Runs, header.RunNumber)
+	}
+	for _, collHdr := range header.PayloadCollections {
+		trailer.summary.TypeBytes[collHdr.Type] += uint64(collHdr.PayloadSize)
+	}
+
+	trailer.index.Entries = append(trailer.index.Entries, IndexEntry{
+		Offset:      offset,
+		HeaderSize:  uint32(headerSize),
+		PayloadSize: uint32(payloadSize),
+		RunNumber:   header.RunNumber,
+		EventNumber: header.EventNumber,
+	})
+}
+
+func (trailer *trailerBuilder) addMetadata(offset int64) {
+	trailer.index.MetadataOffsets = append(trailer.index.MetadataOffsets, offset)
+}
+
+// Begins accumulating the trailer if it is enabled and nothing has been
+// written yet
+func (wrt *Writer) startTrailer() {
+	if wrt.Trailer && wrt.trailer == nil && wrt.bytesWritten == 0 {
+		wrt.trailer = newTrailerBuilder()
+	}
+}
+
+// Writes the trailer record at the end of the stream
+func (wrt *Writer) writeTrailer() error {
+	trailer := wrt.trailer
+	wrt.trailer = nil
+
+	header := trailer.summary.marshal()
+	offset := wrt.bytesWritten
+	frameSize := len(magicBytes) + 8 + len(header) + trailer.index.encodedSize() + trailerFooterSize
+	if wrt.Checksums {
+		frameSize += checksumSize
+	}
+	trailer.index.StreamSize = offset + int64(frameSize)
+
+	payload := bytes.NewBuffer(make([]byte, 0, trailer.index.encodedSize()+trailerFooterSize))
+	trailer.index.Write(payload)
+	var footer [trailerFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[:], uint64(offset))
+	copy(footer[8:], trailerMagicBytes[:])
+	payload.Write(footer[:])
+
+	return wrt.writeRecord(trailerRecord, header, payload.Bytes())
+}
+
+// Returns the summary of the stream recorded in its trailer (see
+// Writer.Trailer), without scanning the stream.  If the stream is not an
+// uncompressed seekable file, or does not end with a trailer that was written
+// along with the rest of the stream (e.g. because streams were concatenated),
+// ErrNoTrailer is returned.  The position of the Reader in the stream is
+// unchanged.
+func (rdr *Reader) Summary() (*Summary, error) {
+	rdr.getMutex.Lock()
+	defer rdr.getMutex.Unlock()
+
+	summary, _, err := rdr.readTrailer()
+	return summary, err
+}
+
+// Returns the index of the stream, from its trailer if it has one, and
+// otherwise by building it with buildIndex()
+func (rdr *Reader) loadIndex() (*Index, error) {
+	if rdr.index != nil {
+		return rdr.index, nil
+	}
+	if _, idx, err := rdr.readTrailer(); err == nil {
+		rdr.index = idx
+		return idx, nil
+	}
+	return rdr.buildIndex()
+}
+
+func (rdr *Reader) readTrailer() (*Summary, *Index, error) {
+	seeker, ok := rdr.byteReader.(io.Seeker)
+	if !ok {
+		return nil, nil, ErrNoTrailer
+	}
+	if _, ok := seeker.(*blockGzipReader); ok {
+		// Virtual offsets cannot be sought from the end
+		return nil, nil, ErrNoTrailer
+	}
+	pos, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer seeker.Seek(pos, 0 /*io.SeekStart*/)
+
+	streamSize, err := seeker.Seek(0, 2 /*io.SeekEnd*/)
+	if err != nil {
+		return nil, nil, err
+	}
+	if streamSize < trailerFooterSize {
+		return nil, nil, ErrNoTrailer
+	}
+	if _, err := seeker.Seek(streamSize-trailerFooterSize, 0 /*io.SeekStart*/); err != nil {
+		return nil, nil, err
+	}
+	var footer [trailerFooterSize]byte
+	if err := readBytes(rdr.byteReader, footer[:]); err != nil {
+		return nil, nil, ErrNoTrailer
+	}
+	if !bytes.Equal(footer[8:], trailerMagicBytes[:]) {
+		return nil, nil, ErrNoTrailer
+	}
+
+	// The trailer must begin exactly where it was written, or else the
+	// stream has been altered since
+	offset := int64(binary.LittleEndian.Uint64(footer[:]))
+	if offset < 0 || offset > streamSize-trailerFooterSize {
+		return nil, nil, ErrNoTrailer
+	}
+	if _, err := seeker.Seek(offset, 0 /*io.SeekStart*/); err != nil {
+		return nil, nil, err
+	}
+	n, recordType, err := rdr.syncToMagic()
+	if err != nil || n != len(magicBytes) || recordType&^checksumFlag != trailerRecord {
+		return nil, nil, ErrNoTrailer
+	}
+	headerSize, payloadSize, checksum, err := rdr.readFrameSizes(recordType)
+	if err != nil {
+		return nil, nil, err
+	}
+	frameEnd, err := seeker.Seek(0, 1 /*io.SeekCurrent*/)
+	if err != nil {
+		return nil, nil, err
+	}
+	frameEnd += int64(headerSize) + int64(payloadSize)
+	if frameEnd != streamSize || payloadSize < trailerFooterSize {
+		return nil, nil, ErrNoTrailer
+	}
+
+	buf := make([]byte, int(headerSize)+int(payloadSize))
+	if err := readBytes(rdr.byteReader, buf); err != nil {
+		return nil, nil, ErrTruncated
+	}
+	header, payload := buf[:headerSize], buf[headerSize:]
+	if recordType&checksumFlag != 0 && frameChecksum(header, payload) != checksum {
+		return nil, nil, ErrChecksum
+	}
+
+	summary, err := unmarshalSummary(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx, err := ReadIndex(bytes.NewReader(payload[:len(payload)-trailerFooterSize]))
+	if err != nil {
+		return nil, nil, ErrBadTrailer
+	}
+	return summary, idx, nil
+}
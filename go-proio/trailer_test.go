@@ -0,0 +1,171 @@
+package proio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func writeTrailerTestStream(t *testing.T, checksums bool) []byte {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.Trailer = true
+	writer.Checksums = checksums
+	writeTestEvents(t, writer, 4, func(i int, event *Event) {
+		if i == 2 {
+			if err := writer.PushMetadata("run", []byte("second")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		event.Header.RunNumber = uint64(2 - i/2)
+	})
+	return buffer.Bytes()
+}
+
+func TestTrailer(t *testing.T) {
+	for _, checksums := range []bool{false, true} {
+		data := writeTrailerTestStream(t, checksums)
+
+		reader := NewReader(bytes.NewReader(data))
+		if reader.AvailableIndex() == nil {
+			t.Error("Trailer index is not available")
+		}
+		summary, err := reader.Summary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.NEvents != 4 || !reflect.DeepEqual(summary.Runs, []uint64{2, 1}) {
+			t.Errorf("Summary has %v events in runs %v", summary.NEvents, summary.Runs)
+		}
+		if len(summary.TypeBytes) != 1 || summary.TypeBytes["lcio.MCParticleCollection"] == 0 {
+			t.Errorf("Summary has type bytes %v", summary.TypeBytes)
+		}
+
+		idx, err := reader.Index()
+		if err != nil {
+			t.Fatal(err)
+		}
+		scannedIdx, err := reader.BuildIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(idx.Entries, scannedIdx.Entries) ||
+			!reflect.DeepEqual(idx.MetadataOffsets, scannedIdx.MetadataOffsets) ||
+			idx.StreamSize != scannedIdx.StreamSize {
+			t.Errorf("Trailer index %+v does not match scanned index %+v", idx, scannedIdx)
+		}
+
+		// Trailers are skipped by Get()
+		nEvents := 0
+		for event, err := reader.Get(); event != nil; event, err = reader.Get() {
+			if err != nil {
+				t.Error(err)
+			}
+			nEvents++
+		}
+		if nEvents != 4 {
+			t.Errorf("Read %v events", nEvents)
+		}
+
+		recoverer := NewReader(bytes.NewReader(data))
+		recoverer.Recover = true
+		recoverer.LostBytes = func(start, end int64) {
+			t.Errorf("Recovery lost bytes %v to %v", start, end)
+		}
+		for i := 0; i < 4; i++ {
+			if _, err := recoverer.Get(); err != nil {
+				t.Error(err)
+			}
+		}
+		if event, err := recoverer.Get(); event != nil || err != io.EOF {
+			t.Errorf("Recovery read past the events, returning %v", err)
+		}
+
+		reader.SetIndex(nil)
+		if err := reader.SeekToRunEvent(1, 3); err != nil {
+			t.Fatal(err)
+		}
+		event, err := reader.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Header.EventNumber != 3 || string(event.Metadata["run"]) != "second" {
+			t.Error("SeekToRunEvent() with trailer index found the wrong event")
+		}
+	}
+}
+
+func TestTrailerConcatenated(t *testing.T) {
+	data := writeTrailerTestStream(t, false)
+	data = append(append([]byte(nil), data...), data...)
+
+	reader := NewReader(bytes.NewReader(data))
+	if _, err := reader.Summary(); err != ErrNoTrailer {
+		t.Errorf("Summary() of concatenated streams returned %v", err)
+	}
+	idx, err := reader.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NEvents() != 8 {
+		t.Errorf("Index of concatenated streams has %v events", idx.NEvents())
+	}
+
+	nEvents := 0
+	for event, err := reader.Get(); event != nil; event, err = reader.Get() {
+		if err != nil {
+			t.Error(err)
+		}
+		nEvents++
+	}
+	if nEvents != 8 {
+		t.Errorf("Read %v events from concatenated streams", nEvents)
+	}
+}
+
+func TestNoTrailer(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeTestEvents(t, NewWriter(buffer), 3, nil)
+	if _, err := NewReader(bytes.NewReader(buffer.Bytes())).Summary(); err != ErrNoTrailer {
+		t.Errorf("Summary() without trailer returned %v", err)
+	}
+
+	// Trailers in gzip streams are skipped but not used
+	buffer = &bytes.Buffer{}
+	writer := NewGzipWriter(buffer)
+	writer.Trailer = true
+	writeTestEvents(t, writer, 3, nil)
+	reader := NewReader(bytes.NewReader(buffer.Bytes()))
+	if _, err := reader.Summary(); err != ErrNoTrailer {
+		t.Errorf("Summary() of gzip stream returned %v", err)
+	}
+	checkTestEvents(t, reader, 3, "gzip")
+}
+
+var errTestWrite = errors.New("write failed")
+
+// failingWriter fails every write once nWrites writes have succeeded
+type failingWriter struct {
+	nWrites int
+}
+
+func (wrt *failingWriter) Write(p []byte) (int, error) {
+	if wrt.nWrites == 0 {
+		return 0, errTestWrite
+	}
+	wrt.nWrites--
+	return len(p), nil
+}
+
+func TestTrailerWriteError(t *testing.T) {
+	writer := NewWriter(&failingWriter{nWrites: 1})
+	writer.Trailer = true
+	if err := writer.Push(NewEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != errTestWrite {
+		t.Errorf("Close() with failing trailer returned %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package proio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrDanglingRef  = errors.New("reference to a message that is not in the event")
+	ErrDupEntryID   = errors.New("duplicate entry id")
+	ErrIDOutOfRange = errors.New("id exceeds the number of unique ids in the event header")
+	ErrPayloadSize  = errors.New("collection payload sizes do not match the event payload")
+)
+
+// ValidationError describes a problem found by (*Event) Validate().  Entry is
+// the index of the offending entry in the collection, or -1 if the problem is
+// with the collection itself.  Field is set for problems with references.
+// Collection is empty for problems with the event as a whole.
+type ValidationError struct {
+	Collection string
+	Entry      int
+	Field      string
+	Err        error
+}
+
+func (err *ValidationError) Error() string {
+	var parts []string
+	if err.Collection != "" {
+		parts = append(parts, "collection "+err.Collection)
+	}
+	if err.Entry >= 0 {
+		parts = append(parts, fmt.Sprint("entry ", err.Entry))
+	}
+	if err.Field != "" {
+		parts = append(parts, "field "+err.Field)
+	}
+	parts = append(parts, err.Err.Error())
+	return strings.Join(parts, ": ")
+}
+
+// ValidationErrors aggregates all problems found by (*Event) Validate()
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks the integrity of the event.  The sizes of serialized
+// collections are checked against the payload, and every collection is then
+// decoded in order to check that collection IDs are unique, that entry IDs are
+// unique within their collections, that no ID exceeds Header.NUniqueIDs
+// (unless it is zero, as in events written by tools that do not count IDs),
+// and that every Reference held by an entry points at a collection or entry in
+// the event.  The event is not modified: collections are decoded without
+// being taken out of the payload.  The returned error is nil or of type
+// ValidationErrors, with each element of type *ValidationError.
+func (evt *Event) Validate() error {
+	var errs ValidationErrors
+	addErr := func(collName string, entry int, field string, err error) {
+		errs = append(errs, &ValidationError{
+			Collection: collName,
+			Entry:      entry,
+			Field:      field,
+			Err:        err,
+		})
+	}
+
+	payloadSize := uint64(0)
+	for _, collHdr := range evt.Header.PayloadCollections {
+		payloadSize += uint64(collHdr.PayloadSize)
+	}
+	if payloadSize != uint64(len(evt.payload)) {
+		// Collections cannot be located in the payload safely
+		addErr("", -1, "", ErrPayloadSize)
+		return errs
+	}
+
+	names := evt.GetNames()
+	sort.Strings(names)
+	checkRange := evt.Header.NUniqueIDs != 0
+
+	colls := make(map[string]Collection)
+	collNames := make(map[uint32]string)
+	ids := make(map[refKey]bool)
+	for _, name := range names {
+		coll, err := evt.peek(name)
+		if err == ErrUnknownType {
+			// Collections of unknown types can still be checked for
+			// corruption, though their contents cannot be validated
+			if dynColl := evt.GetDynamic(name); dynColl != nil {
+				coll, err = dynColl, nil
+			} else {
+				err = ErrCorruptCollection
+			}
+		}
+		if err != nil {
+			addErr(name, -1, "", err)
+			continue
+		}
+		colls[name] = coll
+
+		collID := coll.GetId()
+		if checkRange && collID > evt.Header.NUniqueIDs {
+			addErr(name, -1, "", ErrIDOutOfRange)
+		}
+		if collID != 0 {
+			if _, ok := collNames[collID]; ok {
+				addErr(name, -1, "", ErrDupID)
+			}
+			collNames[collID] = name
+			ids[refKey{collID, 0}] = true
+		}
+
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			entry, ok := coll.GetEntry(i).(Message)
+			if !ok {
+				continue
+			}
+			entryID := entry.GetId()
+			if entryID == 0 {
+				continue
+			}
+			if checkRange && entryID > evt.Header.NUniqueIDs {
+				addErr(name, int(i), "", ErrIDOutOfRange)
+			}
+			key := refKey{collID, entryID}
+			if ids[key] {
+				addErr(name, int(i), "", ErrDupEntryID)
+			}
+			ids[key] = true
+		}
+	}
+
+	for _, name := range names {
+		coll := colls[name]
+		if coll == nil {
+			continue
+		}
+		for i := uint32(0); i < coll.GetNEntries(); i++ {
+			entry, ok := coll.GetEntry(i).(Message)
+			if !ok {
+				continue
+			}
+			visitReferences(entry, "", func(field string, key refKey, _ func(refKey)) bool {
+				if !ids[key] {
+					addErr(name, int(i), field, ErrDanglingRef)
+				}
+				return true
+			})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
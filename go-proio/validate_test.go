@@ -0,0 +1,80 @@
+package proio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+func TestValidate(t *testing.T) {
+	event := NewEvent()
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	part1 := &prolcio.MCParticle{PDG: 11}
+	part2 := &prolcio.MCParticle{PDG: 22}
+	MCParticles.Entries = append(MCParticles.Entries, part1, part2)
+	part2.Parents = append(part2.Parents, event.Reference(part1))
+
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	writer.Push(event)
+	reader := NewReader(buffer)
+	event, _ = reader.Get()
+	if err := event.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	MCParticles = event.Get("MCParticles").(*prolcio.MCParticleCollection)
+	part1 = MCParticles.Entries[0]
+	part2 = MCParticles.Entries[1]
+	part1.Children = append(part1.Children, &model.Reference{CollID: MCParticles.Id, EntryID: 42})
+	part2.Id = part1.Id
+	MCParticles.Entries = append(MCParticles.Entries, &prolcio.MCParticle{Id: 99})
+
+	errs, ok := event.Validate().(ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Validation found %v", errs)
+	}
+	expected := []ValidationError{
+		{"MCParticles", 1, "", ErrDupEntryID},
+		{"MCParticles", 2, "", ErrIDOutOfRange},
+		{"MCParticles", 0, "children", ErrDanglingRef},
+	}
+	for i, expect := range expected {
+		if got := errs[i].(*ValidationError); *got != expect {
+			t.Errorf("Problem %v is %v instead of %v", i, got, &expect)
+		}
+	}
+
+	event = NewEvent()
+	event.Header.PayloadCollections = append(event.Header.PayloadCollections, &model.EventHeader_CollectionHeader{
+		Name:        "Truncated",
+		Type:        "lcio.MCParticleCollection",
+		PayloadSize: 10,
+	})
+	if errs, ok := event.Validate().(ValidationErrors); !ok || errs[0].(*ValidationError).Err != ErrPayloadSize {
+		t.Errorf("Payload size mismatch was not found")
+	}
+}
+
+func TestValidateSample(t *testing.T) {
+	filename := "../samples/smallSample.proio"
+	reader, err := Open(filename)
+	if err != nil {
+		t.Skip("Skipping sample validation test: missing input file ", filename)
+	}
+	defer reader.Close()
+
+	// Files converted from LCIO do not count their IDs in NUniqueIDs
+	for event, _ := reader.Get(); event != nil; event, _ = reader.Get() {
+		nPayloadColls := len(event.Header.PayloadCollections)
+		if err := event.Validate(); err != nil {
+			t.Fatalf("Event %v: %v", event.Header.EventNumber, err)
+		}
+		if len(event.Header.PayloadCollections) != nPayloadColls {
+			t.Fatal("Validate() took collections out of the payload")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package proio
+
+import (
+	"errors"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+)
+
+// The version of the stream format that Writers stamp into the Version field
+// of each event header, as FormatMajorVersion<<16 | FormatMinorVersion.  The
+// major version changes when the layout of frames or the meaning of existing
+// header fields changes in a way that older readers cannot handle, and the
+// minor version changes when something is added that older readers can safely
+// ignore.  Readers accept events of any minor version of a major version they
+// support, and reject events of newer major versions with
+// ErrUnsupportedVersion.  Events written before versions were stamped carry
+// version 0, and are read as version 1.0.
+const (
+	FormatMajorVersion = 1
+	FormatMinorVersion = 0
+	FormatVersion      = FormatMajorVersion<<16 | FormatMinorVersion
+)
+
+var ErrUnsupportedVersion = errors.New("event was written in a newer major version of the stream format")
+
+// HeaderVersion returns the major and minor format versions of an event
+// header.  Unversioned headers are reported as version 1.0.
+func HeaderVersion(header *model.EventHeader) (major, minor uint32) {
+	if header.Version == 0 {
+		return 1, 0
+	}
+	return header.Version >> 16, header.Version & 0xffff
+}
+
+// Returns ErrUnsupportedVersion if the header is of a major format version
+// that this library cannot read
+func checkVersion(header *model.EventHeader) error {
+	if major, _ := HeaderVersion(header); major > FormatMajorVersion {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package proio
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/decibelcooper/proio/go-proio/model"
+	prolcio "github.com/decibelcooper/proio/go-proio/model/lcio"
+)
+
+// Golden files in testdata/ hold streams written by each version of the
+// format, and must keep reading correctly.  Files for the current version are
+// also compared byte for byte with the output of the Writer, and can be
+// regenerated with "go test -run Golden -update" when the format version is
+// deliberately changed.  Files of older versions must never be regenerated.
+var updateGolden = flag.Bool("update", false, "regenerate golden files of the current format version")
+
+func newGoldenEvent(i int) *Event {
+	event := NewEvent()
+	event.Header.RunNumber = 1
+	event.Header.EventNumber = uint64(i)
+
+	MCParticles := &prolcio.MCParticleCollection{}
+	event.Add(MCParticles, "MCParticles")
+	parent := &prolcio.MCParticle{PDG: 11, Charge: -1}
+	child := &prolcio.MCParticle{PDG: 22, P: []float64{1, 2, float64(i)}}
+	MCParticles.Entries = append(MCParticles.Entries, parent, child)
+	child.Parents = append(child.Parents, event.Reference(parent))
+
+	hits := &prolcio.SimTrackerHitCollection{}
+	event.Add(hits, "TrackerHits")
+	hits.Entries = append(hits.Entries, &prolcio.SimTrackerHit{EDep: 0.5, Mc: event.Reference(child)})
+	return event
+}
+
+var goldenFiles = []struct {
+	filename string
+	metadata map[string]string
+	// Whether the file is reproduced exactly by write
+	exact bool
+	// Whether the file ends with a trailer
+	trailer bool
+	write   func(writer *Writer) error
+}{
+	{filename: "v0.proio"},
+	{
+		filename: "v1.0.proio",
+		metadata: map[string]string{"geometry": "golden"},
+		exact:    true,
+		write: func(writer *Writer) error {
+			if err := writer.PushMetadata("geometry", []byte("golden")); err != nil {
+				return err
+			}
+			for i := 0; i < 3; i++ {
+				writer.Checksums = i > 0
+				if err := writer.Push(newGoldenEvent(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		filename: "v1.0-trailer.proio",
+		exact:    true,
+		trailer:  true,
+		write: func(writer *Writer) error {
+			writer.Trailer = true
+			for i := 0; i < 3; i++ {
+				if err := writer.Push(newGoldenEvent(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		filename: "v1.0-gzip-payloads.proio",
+		write: func(writer *Writer) error {
+			writer.PayloadCodec = GetCodec("gzip")
+			for i := 0; i < 3; i++ {
+				if err := writer.Push(newGoldenEvent(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+func writeGoldenFile(t *testing.T, write func(writer *Writer) error) []byte {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	if err := write(writer); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestGoldenFiles(t *testing.T) {
+	for _, golden := range goldenFiles {
+		filename := filepath.Join("testdata", golden.filename)
+		if *updateGolden && golden.write != nil {
+			if err := ioutil.WriteFile(filename, writeGoldenFile(t, golden.write), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if golden.exact && !bytes.Equal(writeGoldenFile(t, golden.write), data) {
+			t.Errorf("%v: Writer output differs from golden file", golden.filename)
+		}
+
+		reader := NewReader(bytes.NewReader(data))
+		if golden.trailer {
+			summary, err := reader.Summary()
+			if err != nil {
+				t.Fatalf("%v: %v", golden.filename, err)
+			}
+			if summary.NEvents != 3 || len(summary.Runs) != 1 || len(summary.TypeBytes) != 2 {
+				t.Errorf("%v: wrong summary %+v", golden.filename, summary)
+			}
+			if idx, err := reader.Index(); err != nil || idx.NEvents() != 3 {
+				t.Errorf("%v: wrong trailer index", golden.filename)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			event, err := reader.Get()
+			if err != nil {
+				t.Fatalf("%v: %v", golden.filename, err)
+			}
+			checkGoldenEvent(t, golden.filename, i, event)
+			for key, value := range golden.metadata {
+				if string(event.Metadata[key]) != value {
+					t.Errorf("%v: event %v has metadata %v = %q", golden.filename, i, key, event.Metadata[key])
+				}
+			}
+		}
+		if event, _ := reader.Get(); event != nil {
+			t.Errorf("%v: read extra event", golden.filename)
+		}
+	}
+}
+
+func checkGoldenEvent(t *testing.T, filename string, i int, event *Event) {
+	if event.Header.RunNumber != 1 || event.Header.EventNumber != uint64(i) {
+		t.Errorf("%v: event %v has wrong header", filename, i)
+	}
+
+	MCParticles, ok := event.Get("MCParticles").(*prolcio.MCParticleCollection)
+	if !ok || len(MCParticles.Entries) != 2 {
+		t.Fatalf("%v: event %v has wrong MCParticles", filename, i)
+	}
+	parent, child := MCParticles.Entries[0], MCParticles.Entries[1]
+	if parent.PDG != 11 || parent.Charge != -1 || child.PDG != 22 || len(child.P) != 3 || child.P[2] != float64(i) {
+		t.Errorf("%v: event %v has wrong MCParticles", filename, i)
+	}
+	if len(child.Parents) != 1 || event.Dereference(child.Parents[0]) != parent {
+		t.Errorf("%v: event %v has wrong parent reference", filename, i)
+	}
+
+	hits, ok := event.Get("TrackerHits").(*prolcio.SimTrackerHitCollection)
+	if !ok || len(hits.Entries) != 1 {
+		t.Fatalf("%v: event %v has wrong TrackerHits", filename, i)
+	}
+	if hits.Entries[0].EDep != 0.5 || event.Dereference(hits.Entries[0].Mc) != child {
+		t.Errorf("%v: event %v has wrong TrackerHits", filename, i)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+	for _, version := range []uint32{FormatVersion, FormatVersion + 1, (FormatMajorVersion + 1) << 16, 0} {
+		header, err := (&model.EventHeader{Version: version}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.writeRecord(eventRecord, header, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := NewEvent()
+	writer.Push(event)
+	writer.Close()
+	if event.Header.Version != FormatVersion {
+		t.Errorf("Writer stamped version %v", event.Header.Version)
+	}
+
+	data := buffer.Bytes()
+	reader := NewReader(bytes.NewReader(data))
+	for i, expectedErr := range []error{nil, nil, ErrUnsupportedVersion, nil, nil} {
+		if _, err := reader.Get(); err != expectedErr {
+			t.Errorf("Get() of event %v returned %v", i, err)
+		}
+	}
+
+	reader = NewReader(bytes.NewReader(data))
+	for i, expectedErr := range []error{nil, nil, ErrUnsupportedVersion, nil, nil} {
+		if _, err := reader.GetHeader(); err != expectedErr {
+			t.Errorf("GetHeader() of event %v returned %v", i, err)
+		}
+	}
+
+	if major, minor := HeaderVersion(&model.EventHeader{}); major != 1 || minor != 0 {
+		t.Errorf("Unversioned header reported as version %v.%v", major, minor)
+	}
+}
@@ -1,22 +1,79 @@
 package proio
 
 import (
-	"compress/gzip"
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"hash/crc32"
 	"io"
 	"os"
+	"sort"
 	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
 )
 
 type Writer struct {
+	// If EmbedDescriptors is true, the protobuf descriptors of every
+	// collection type pushed are written into the stream as metadata, so that
+	// the stream can be read and inspected by binaries that do not have the
+	// data model compiled in.  Readers predating this feature skip the
+	// metadata, reporting ErrResync.
+	EmbedDescriptors bool
+
+	// If PayloadCodec is set, the payload of each event is compressed
+	// independently with the codec, while the event header is left
+	// uncompressed.  Unlike compressing the whole stream, this keeps the
+	// stream seekable, and allows GetHeader() and Skip() to pass over events
+	// without decompressing them.  The codec must have a nonzero ID.  Readers
+	// predating this feature skip these events, reporting ErrResync.
+	PayloadCodec *Codec
+
+	// If GzipBlockSize is positive and the stream is gzip compressed by
+	// NewGzipWriter() or Create(), the gzip stream is split into independent
+	// members (as in BGZF), with a new member started at the first record
+	// boundary after GzipBlockSize uncompressed bytes.  The result is still an
+	// ordinary gzip stream, but its members are marked in their headers, so
+	// that a Reader of a seekable file can then seek within it, e.g. with
+	// BuildIndex() and SeekToEvent().  Values above MaxGzipBlockSize are
+	// reduced to it.  GzipBlockSize must be set before anything is written.
+	GzipBlockSize int
+
+	// If Checksums is true, every record is written with CRC-32C checksums
+	// of its sizes and contents, which are verified by Readers to detect
+	// corruption (see ErrChecksum).  Readers predating this feature still
+	// read the events, without verifying them.
+	Checksums bool
+
+	// If Trailer is true, Close() appends a trailer record to the stream,
+	// holding a Summary of the events written and an Index of the records,
+	// so that Readers of uncompressed files can find them without scanning
+	// the stream (see (*Reader) Summary() and (*Reader) Index()).  Trailer
+	// must be set before anything is written, since offsets are counted from
+	// where the Writer started writing.  Readers predating this feature skip
+	// the trailer, reporting ErrResync.
+	Trailer bool
+
 	byteWriter         io.Writer
 	deferredUntilClose []func() error
+	describedTypes     map[string]bool
+	describedFiles     map[string]bool
+
+	blockBytes    int
+	frameBuf      []byte
+	err           error
+	bytesWritten  int64
+	eventsWritten int64
+	trailer       *trailerBuilder
+	metadata      map[string][]byte
 }
 
 // Creates a new file (overwriting existing file) and adds the file as an
-// io.Writer to a new Writer that is returned.  If the file name ends with
-// ".gz", the file is wrapped with gzip.NewWriter().  If the function returns
-// successful (err == nil), the Close() function should be called when
+// io.Writer to a new Writer that is returned.  If the file name ends with the
+// suffix of a registered Codec that supports writing (e.g. ".gz", ".zst",
+// ".lz4" or ".xz"), the file is compressed with that codec.  If the function
+// returns successful (err == nil), the Close() function should be called when
 // finished.
 func Create(filename string) (*Writer, error) {
 	file, err := os.Create(filename)
@@ -25,8 +82,12 @@ func Create(filename string) (*Writer, error) {
 	}
 
 	var writer *Writer
-	if strings.HasSuffix(filename, ".gz") {
-		writer = NewGzipWriter(file)
+	if codec := codecForFilename(filename); codec != nil {
+		writer, err = NewCompressedWriter(file, codec)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
 	} else {
 		writer = NewWriter(file)
 	}
@@ -35,14 +96,51 @@ func Create(filename string) (*Writer, error) {
 	return writer, nil
 }
 
-// Closes anything created by Create() or NewGzipWriter()
+// Writes the trailer if enabled (see Writer.Trailer), flushes the stream and
+// closes anything created by Create() or NewGzipWriter().  The first error
+// encountered is returned, including any error previously returned by Push().
 func (wrt *Writer) Close() error {
+	var err error
+	if wrt.trailer != nil && wrt.err == nil {
+		err = wrt.writeTrailer()
+	}
+	if flushErr := wrt.Flush(); err == nil {
+		err = flushErr
+	}
 	for _, thisFunc := range wrt.deferredUntilClose {
-		if err := thisFunc(); err != nil {
-			return err
+		if closeErr := thisFunc(); closeErr != nil && err == nil {
+			err = closeErr
 		}
 	}
-	return nil
+	wrt.deferredUntilClose = nil
+	return err
+}
+
+// Flushes any data buffered by the underlying io.Writer, if it implements a
+// Flush() method (as gzip.Writer and bufio.Writer do).  Since each event is
+// written with a single call to Write(), streaming consumers see only whole
+// events after a flush.
+func (wrt *Writer) Flush() error {
+	if wrt.err != nil {
+		return wrt.err
+	}
+	if flusher, ok := wrt.byteWriter.(interface {
+		Flush() error
+	}); ok {
+		wrt.err = flusher.Flush()
+	}
+	return wrt.err
+}
+
+// Returns the number of bytes successfully written to the stream, before any
+// compression
+func (wrt *Writer) BytesWritten() int64 {
+	return wrt.bytesWritten
+}
+
+// Returns the number of events successfully pushed to the stream
+func (wrt *Writer) EventsWritten() int64 {
+	return wrt.eventsWritten
 }
 
 func (wrt *Writer) deferUntilClose(thisFunc func() error) {
@@ -59,7 +157,7 @@ func NewWriter(byteWriter io.Writer) *Writer {
 // Creates a gzip stream and adds it as an io.Writer to a new Writer that is
 // returned.  The Close() function should be called before closing the stream.
 func NewGzipWriter(byteWriter io.Writer) *Writer {
-	gzWriter := gzip.NewWriter(byteWriter)
+	gzWriter := newBlockGzipWriter(byteWriter)
 	writer := NewWriter(gzWriter)
 	writer.deferUntilClose(gzWriter.Close)
 
@@ -73,30 +171,237 @@ var magicBytes = [...]byte{
 	byte(0x00),
 }
 
+// The final byte of the magic number identifies the type of record that
+// follows.  Every record has the same framing as an event: two little-endian
+// sizes followed by the two corresponding blocks of bytes.
+const (
+	eventRecord           = 0x00
+	metadataRecord        = 0x01
+	compressedEventRecord = 0x02
+	trailerRecord         = 0x03
+)
+
 // Pushes an event into the Writer's stream.  Any unserialized collections are
-// serialized first.
-func (wrt *Writer) Push(event *Event) (err error) {
+// serialized first, and the header is stamped with FormatVersion.  The event
+// is framed in a buffer and written to the stream with a single call to
+// Write().  If writing fails, the error is returned, and is also returned by
+// all subsequent calls to Push(), Flush() and Close(), since the stream is
+// left in an unknown state.
+func (wrt *Writer) Push(event *Event) error {
+	if wrt.err != nil {
+		return wrt.err
+	}
+	wrt.startTrailer()
+
 	if err := event.flushCollCache(); err != nil {
 		return err
 	}
 
+	if wrt.EmbedDescriptors {
+		if err := wrt.pushDescriptors(event); err != nil {
+			return err
+		}
+	}
+
+	event.Header.Version = FormatVersion
 	headerBuf, err := event.Header.Marshal()
 	if err != nil {
-		return
+		return err
 	}
+	payload := event.getPayload()
 
-	headerSizeBuf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(headerSizeBuf, uint32(len(headerBuf)))
+	recordType := byte(eventRecord)
+	if wrt.PayloadCodec != nil {
+		if payload, err = compressPayload(payload, wrt.PayloadCodec); err != nil {
+			return err
+		}
+		recordType = compressedEventRecord
+	}
+	if wrt.Checksums {
+		headerBuf = addHeaderChecksum(headerBuf, payload)
+	}
 
-	payload := event.getPayload()
-	payloadSizeBuf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(payloadSizeBuf, uint32(len(payload)))
+	offset := wrt.bytesWritten
+	if err := wrt.writeRecord(recordType, headerBuf, payload); err != nil {
+		return err
+	}
+	wrt.eventsWritten++
+	if wrt.trailer != nil {
+		wrt.trailer.addEvent(offset, event.Header, len(headerBuf), len(payload))
+	}
+
+	return nil
+}
+
+// Frames and writes a record of any type
+func (wrt *Writer) writeRecord(recordType byte, header []byte, payload []byte) error {
+	if err := wrt.startGzipBlock(); err != nil {
+		return err
+	}
+
+	sizesEnd := len(magicBytes) + 8
+	dataStart := sizesEnd
+	// Event records carry their checksums in their headers
+	checked := wrt.Checksums && recordType != eventRecord && recordType != compressedEventRecord
+	if checked {
+		recordType |= checksumFlag
+		dataStart += checksumSize
+	}
+
+	frameSize := dataStart + len(header) + len(payload)
+	if cap(wrt.frameBuf) < frameSize {
+		wrt.frameBuf = make([]byte, frameSize)
+	}
+	buf := wrt.frameBuf[:frameSize]
+
+	copy(buf, magicBytes[:])
+	buf[len(magicBytes)-1] = recordType
+	binary.LittleEndian.PutUint32(buf[len(magicBytes):], uint32(len(header)))
+	binary.LittleEndian.PutUint32(buf[len(magicBytes)+4:], uint32(len(payload)))
+	if checked {
+		binary.LittleEndian.PutUint32(buf[sizesEnd:], crc32.Checksum(buf[len(magicBytes):sizesEnd], crcTable))
+		binary.LittleEndian.PutUint32(buf[sizesEnd+4:], frameChecksum(header, payload))
+	}
+	copy(buf[dataStart:], header)
+	copy(buf[dataStart+len(header):], payload)
 
-	wrt.byteWriter.Write(magicBytes[:])
-	wrt.byteWriter.Write(headerSizeBuf)
-	wrt.byteWriter.Write(payloadSizeBuf)
-	wrt.byteWriter.Write(headerBuf)
-	wrt.byteWriter.Write(payload)
+	n, err := wrt.byteWriter.Write(buf)
+	wrt.bytesWritten += int64(n)
+	wrt.blockBytes += n
+	if err == nil && n < len(buf) {
+		err = io.ErrShortWrite
+	}
+	wrt.err = err
+	return err
+}
+
+// Begins a new gzip member if the current one has reached GzipBlockSize
+func (wrt *Writer) startGzipBlock() error {
+	gzWriter, ok := wrt.byteWriter.(*blockGzipWriter)
+	if !ok || wrt.GzipBlockSize <= 0 {
+		return nil
+	}
+	if wrt.blockBytes == 0 {
+		// Nothing has been written to the first member yet
+		gzWriter.markBlocked()
+		return nil
+	}
+	blockSize := wrt.GzipBlockSize
+	if blockSize > MaxGzipBlockSize {
+		blockSize = MaxGzipBlockSize
+	}
+	if wrt.blockBytes < blockSize {
+		return nil
+	}
+
+	wrt.err = gzWriter.newMember()
+	wrt.blockBytes = 0
+	return wrt.err
+}
+
+// Writes a metadata record containing the descriptors for any collection types
+// in the event that have not yet been described in the stream
+func (wrt *Writer) pushDescriptors(event *Event) error {
+	if wrt.describedTypes == nil {
+		wrt.describedTypes = make(map[string]bool)
+		wrt.describedFiles = make(map[string]bool)
+	}
+
+	files := make(map[string]*descriptor.FileDescriptorProto)
+	for _, collHdr := range event.Header.PayloadCollections {
+		if wrt.describedTypes[collHdr.Type] {
+			continue
+		}
+		wrt.describedTypes[collHdr.Type] = true
+
+		describeType("proio.model."+collHdr.Type, event.descriptors, files)
+	}
+
+	// Files are sorted so that identical streams are written identically
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if !wrt.describedFiles[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fileSet := &descriptor.FileDescriptorSet{}
+	for _, name := range names {
+		wrt.describedFiles[name] = true
+		fileSet.File = append(fileSet.File, files[name])
+	}
+	if len(fileSet.File) == 0 {
+		return nil
+	}
+
+	value, err := proto.Marshal(fileSet)
+	if err != nil {
+		return err
+	}
+	return wrt.pushMetadata(descriptorsKey, value)
+}
+
+var ErrReservedKey = errors.New("metadata keys beginning with \"proio.\" are reserved")
+
+// Pushes a metadata record into the stream.  Readers apply the metadata to all
+// of the events that follow it in the stream (see Event.Metadata), until it is
+// replaced by metadata with the same key.  Since metadata are part of the
+// stream, they survive concatenation of streams, with the metadata of each
+// stream taking effect where it begins.  Keys that a later stream does not set
+// keep their values from the earlier streams, though.  Keys beginning with
+// "proio." are reserved.  Readers predating this feature skip the metadata,
+// reporting ErrResync.
+func (wrt *Writer) PushMetadata(key string, value []byte) error {
+	if strings.HasPrefix(key, "proio.") {
+		return ErrReservedKey
+	}
+	if err := wrt.pushMetadata(key, value); err != nil {
+		return err
+	}
+	if wrt.metadata == nil {
+		wrt.metadata = make(map[string][]byte)
+	}
+	wrt.metadata[key] = value
+	return nil
+}
+
+// Pushes the entries of the metadata that differ from what has been pushed
+// with PushMetadata() so far, in order of key.  This carries the metadata of
+// events read from another stream (see Event.Metadata) over to this one when
+// called before pushing each event.  Reserved keys are skipped.
+func (wrt *Writer) UpdateMetadata(metadata map[string][]byte) error {
+	keys := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if strings.HasPrefix(key, "proio.") {
+			continue
+		}
+		if pushed, ok := wrt.metadata[key]; !ok || !bytes.Equal(pushed, value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
 
-	return
+	for _, key := range keys {
+		if err := wrt.PushMetadata(key, metadata[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wrt *Writer) pushMetadata(key string, value []byte) error {
+	if wrt.err != nil {
+		return wrt.err
+	}
+	wrt.startTrailer()
+
+	offset := wrt.bytesWritten
+	if err := wrt.writeRecord(metadataRecord, []byte(key), value); err != nil {
+		return err
+	}
+	if wrt.trailer != nil {
+		wrt.trailer.addMetadata(offset)
+	}
+	return nil
 }